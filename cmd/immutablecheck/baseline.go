@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// Baseline flags: -baseline names the file of accepted findings, which are
+// then not reported; -write-baseline records the current findings instead.
+var (
+	baselinePath  string
+	writeBaseline bool
+)
+
+// baselineHeader starts every baseline file.
+const baselineHeader = "# immutablecheck baseline: package, function, field, snippet (tab-separated)"
+
+// baselineKey identifies a finding independently of its line number: the
+// package, the enclosing function, the immutable field and the source line
+// with whitespace normalised.
+type baselineKey struct {
+	Pkg, Func, Field, Snippet string
+}
+
+func (k baselineKey) String() string {
+	return strings.Join([]string{k.Pkg, k.Func, k.Field, k.Snippet}, "\t")
+}
+
+var baselineState struct {
+	once sync.Once
+	mu   sync.Mutex
+	pkgs map[string][]baselineKey // entries by package path
+	err  error
+}
+
+// loadBaseline reads the baseline file once per process. In write mode a
+// missing file is not an error.
+func loadBaseline() error {
+	s := &baselineState
+	s.once.Do(func() {
+		data, err := os.ReadFile(baselinePath)
+		if err != nil {
+			s.pkgs = make(map[string][]baselineKey)
+			if !(writeBaseline && os.IsNotExist(err)) {
+				s.err = fmt.Errorf("read baseline: %v", err)
+			}
+			return
+		}
+		s.pkgs, s.err = parseBaseline(data)
+	})
+	return s.err
+}
+
+// parseBaseline returns the entries of a baseline file by package path.
+func parseBaseline(data []byte) (map[string][]baselineKey, error) {
+	pkgs := make(map[string][]baselineKey)
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		line := sc.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.Split(line, "\t")
+		if len(parts) != 4 {
+			return nil, fmt.Errorf("%s:%d: malformed baseline entry", baselinePath, n)
+		}
+		k := baselineKey{parts[0], parts[1], parts[2], parts[3]}
+		pkgs[k.Pkg] = append(pkgs[k.Pkg], k)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("read baseline: %v", err)
+	}
+	return pkgs, nil
+}
+
+// baselineEntries returns how often each finding of pkg is in the baseline.
+func baselineEntries(pkg string) map[baselineKey]int {
+	s := &baselineState
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counts := make(map[baselineKey]int)
+	for _, k := range s.pkgs[pkg] {
+		counts[k]++
+	}
+	return counts
+}
+
+// recordBaseline replaces the entries of pkg with keys in the baseline file.
+// Entries of packages not analyzed are kept.
+//
+// Drivers such as go vet -vettool run one process per package, possibly in
+// parallel, so the file is re-read and replaced while holding a lock file
+// rather than written from the entries this process loaded.
+func recordBaseline(pkg string, keys []baselineKey) error {
+	s := &baselineState
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	unlock, err := lockBaseline()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	pkgs := make(map[string][]baselineKey)
+	data, err := os.ReadFile(baselinePath)
+	switch {
+	case err == nil:
+		if pkgs, err = parseBaseline(data); err != nil {
+			return err
+		}
+	case !os.IsNotExist(err):
+		return fmt.Errorf("read baseline: %v", err)
+	}
+	if len(keys) == 0 {
+		if _, ok := pkgs[pkg]; !ok {
+			return nil // nothing recorded before or now
+		}
+		delete(pkgs, pkg)
+	} else {
+		pkgs[pkg] = keys
+	}
+
+	var lines []string
+	for _, keys := range pkgs {
+		for _, k := range keys {
+			lines = append(lines, k.String())
+		}
+	}
+	slices.Sort(lines)
+
+	var buf bytes.Buffer
+	buf.WriteString(baselineHeader + "\n")
+	for _, line := range lines {
+		buf.WriteString(line + "\n")
+	}
+	// Readers never see a partly written file.
+	tmp := baselinePath + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o666); err != nil {
+		return fmt.Errorf("write baseline: %v", err)
+	}
+	if err := os.Rename(tmp, baselinePath); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("write baseline: %v", err)
+	}
+	return nil
+}
+
+// baselineLockTimeout bounds the wait for another process writing the
+// baseline.
+const baselineLockTimeout = time.Minute
+
+// lockBaseline acquires the lock file of the baseline, which only one
+// process can create at a time, and returns the function releasing it.
+func lockBaseline() (unlock func(), err error) {
+	lock := baselinePath + ".lock"
+	deadline := time.Now().Add(baselineLockTimeout)
+	for {
+		f, err := os.OpenFile(lock, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o666)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(lock) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("lock baseline: %v", err)
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("lock baseline: %s still exists after %v; remove it if no immutablecheck is running", lock, baselineLockTimeout)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// findingKey returns the baseline key of a finding at pos concerning field.
+func findingKey(pass *analysis.Pass, pos token.Pos, field *types.Var) baselineKey {
+	k := baselineKey{Pkg: pass.Pkg.Path(), Func: "-", Field: field.Name()}
+	if owner := fieldOwner(field); owner != "" {
+		k.Field = owner + "." + field.Name()
+	}
+
+	for _, f := range pass.Files {
+		if f.FileStart <= pos && pos <= f.FileEnd {
+			for _, decl := range f.Decls {
+				if fn, ok := decl.(*ast.FuncDecl); ok && fn.Pos() <= pos && pos <= fn.End() {
+					k.Func = funcName(fn)
+				}
+			}
+		}
+	}
+
+	if tf := pass.Fset.File(pos); tf != nil {
+		if src, err := pass.ReadFile(tf.Name()); err == nil {
+			start := tf.Offset(tf.LineStart(tf.Line(pos)))
+			end := bytes.IndexByte(src[start:], '\n')
+			if end < 0 {
+				end = len(src) - start
+			}
+			k.Snippet = strings.Join(strings.Fields(string(src[start:start+end])), " ")
+		}
+	}
+	return k
+}
+
+// fieldOwner returns the name of the named struct type declaring field, or
+// "" if it cannot be determined.
+func fieldOwner(field *types.Var) string {
+	if field.Pkg() == nil {
+		return ""
+	}
+	scope := field.Pkg().Scope()
+	for _, name := range scope.Names() {
+		tn, ok := scope.Lookup(name).(*types.TypeName)
+		if !ok {
+			continue
+		}
+		if st, ok := tn.Type().Underlying().(*types.Struct); ok {
+			for i := 0; i < st.NumFields(); i++ {
+				if st.Field(i) == field {
+					return name
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// funcName returns the name of fn as F, T.M or (*T).M.
+func funcName(fn *ast.FuncDecl) string {
+	if fn.Recv == nil || len(fn.Recv.List) == 0 {
+		return fn.Name.Name
+	}
+	recv := fn.Recv.List[0].Type
+	ptr := false
+	if star, ok := recv.(*ast.StarExpr); ok {
+		recv, ptr = star.X, true
+	}
+	switch r := recv.(type) {
+	case *ast.IndexExpr:
+		recv = r.X
+	case *ast.IndexListExpr:
+		recv = r.X
+	}
+	name := types.ExprString(recv)
+	if ptr {
+		return "(*" + name + ")." + fn.Name.Name
+	}
+	return name + "." + fn.Name.Name
+}
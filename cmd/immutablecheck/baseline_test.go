@@ -0,0 +1,87 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/tools/go/analysis/analysistest"
+)
+
+const baselineSrc = `package legacy
+
+type Account struct {
+	ID string ` + "`immutable:\"true\"`" + ` // want ID:` + "`immutable\\(tag\\)`" + `
+}
+
+func rename(a *Account) {
+	a.ID = "x"%s
+}
+`
+
+// runBaseline analyzes src as package legacy with the given baseline flags,
+// starting from a fresh process state.
+func runBaseline(t *testing.T, dir, src, path string, write bool) {
+	t.Helper()
+	pkg := filepath.Join(dir, "src", "legacy")
+	if err := os.MkdirAll(pkg, 0o777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(pkg, "legacy.go"), []byte(src), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	baselineState.once = sync.Once{}
+	baselineState.pkgs, baselineState.err = nil, nil
+	baselinePath, writeBaseline = path, write
+	t.Cleanup(func() { baselinePath, writeBaseline = "", false })
+	analysistest.Run(t, dir, Analyzer, "legacy")
+}
+
+func TestBaselineRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(t.TempDir(), "baseline.txt")
+
+	runBaseline(t, dir, strings.Replace(baselineSrc, "%s", "", 1), path, true)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "legacy\trename\tAccount.ID\ta.ID = \"x\"") {
+		t.Fatalf("baseline does not record the finding:\n%s", data)
+	}
+
+	// Lines shifted: the recorded finding is still accepted.
+	shifted := strings.Replace(baselineSrc, "\ntype", "\n// Account is an account.\n\n\ntype", 1)
+	runBaseline(t, dir, strings.Replace(shifted, "%s", "", 1), path, false)
+
+	// A second identical write is not covered by the single entry.
+	again := "\n\ta.ID = \"x\" // want `immutable field ID`"
+	runBaseline(t, dir, strings.Replace(shifted, "%s", again, 1), path, false)
+}
+
+func TestBaselineKeepsOtherPackages(t *testing.T) {
+	baselinePath = filepath.Join(t.TempDir(), "baseline.txt")
+	t.Cleanup(func() { baselinePath = "" })
+	// Written by another process after this one loaded the baseline.
+	other := baselineHeader + "\nexample.com/a\tF\tT.ID\tx.ID = 1\n"
+	if err := os.WriteFile(baselinePath, []byte(other), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	if err := recordBaseline("example.com/b", []baselineKey{{"example.com/b", "G", "T.ID", "y.ID = 2"}}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(baselinePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"example.com/a\t", "example.com/b\t"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("baseline lost %q:\n%s", want, data)
+		}
+	}
+	if _, err := os.Stat(baselinePath + ".lock"); !os.IsNotExist(err) {
+		t.Errorf("lock file left behind: %v", err)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"go/ast"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// inPlaceMutators lists the builtins and well-known standard library
+// functions that modify one of their arguments in place, by argument index.
+var inPlaceMutators = map[string]int{
+	// builtins
+	"delete": 0,
+	"clear":  0,
+	"copy":   0, // destination
+	"append": 0, // may write into the backing array of its first argument
+
+	"sort.Sort":             0,
+	"sort.Stable":           0,
+	"sort.Slice":            0,
+	"sort.SliceStable":      0,
+	"sort.Ints":             0,
+	"sort.Float64s":         0,
+	"sort.Strings":          0,
+	"slices.Sort":           0,
+	"slices.SortFunc":       0,
+	"slices.SortStableFunc": 0,
+	"slices.Reverse":        0,
+	"slices.Delete":         0,
+	"slices.DeleteFunc":     0,
+	"slices.Compact":        0,
+	"slices.CompactFunc":    0,
+	"slices.Replace":        0,
+	"maps.Copy":             0, // destination
+	"maps.DeleteFunc":       0,
+}
+
+// mutatedArg returns the callee name and the argument that call modifies in
+// place, or "" and nil if call is not a known in-place mutator.
+func mutatedArg(pass *analysis.Pass, call *ast.CallExpr) (string, ast.Expr) {
+	var name string
+	switch fn := typeutil.Callee(pass.TypesInfo, call).(type) {
+	case *types.Builtin:
+		name = fn.Name()
+	case *types.Func:
+		if fn.Pkg() == nil || fn.Signature().Recv() != nil {
+			return "", nil
+		}
+		name = fn.Pkg().Path() + "." + fn.Name()
+	default:
+		return "", nil
+	}
+	i, ok := inPlaceMutators[name]
+	if !ok || i >= len(call.Args) {
+		return "", nil
+	}
+	return name, call.Args[i]
+}
+
+// pointerWriters lists well-known functions and methods that store through
+// the pointers they are passed, by the index of the first such argument; all
+// later arguments are written too. Passing the address of an immutable field
+// to them is a write; passing it to other functions is only reported with
+// -address-of.
+var pointerWriters = map[string]int{
+	"fmt.Scan":    0,
+	"fmt.Scanf":   1,
+	"fmt.Scanln":  0,
+	"fmt.Sscan":   1,
+	"fmt.Sscanf":  2,
+	"fmt.Sscanln": 1,
+	"fmt.Fscan":   1,
+	"fmt.Fscanf":  2,
+	"fmt.Fscanln": 1,
+
+	"encoding/json.Unmarshal":                    1,
+	"(*encoding/json.Decoder).Decode":            0,
+	"encoding/xml.Unmarshal":                     1,
+	"(*encoding/xml.Decoder).Decode":             0,
+	"(*encoding/gob.Decoder).Decode":             0,
+	"encoding/binary.Read":                       2,
+	"google.golang.org/protobuf/proto.Unmarshal": 1,
+	"google.golang.org/protobuf/proto.Merge":     0,
+	"google.golang.org/protobuf/proto.Reset":     0,
+
+	"flag.BoolVar":     0,
+	"flag.IntVar":      0,
+	"flag.Int64Var":    0,
+	"flag.UintVar":     0,
+	"flag.Uint64Var":   0,
+	"flag.StringVar":   0,
+	"flag.Float64Var":  0,
+	"flag.DurationVar": 0,
+
+	"sync/atomic.StoreInt32":          0,
+	"sync/atomic.StoreInt64":          0,
+	"sync/atomic.StoreUint32":         0,
+	"sync/atomic.StoreUint64":         0,
+	"sync/atomic.AddInt32":            0,
+	"sync/atomic.AddInt64":            0,
+	"sync/atomic.AddUint32":           0,
+	"sync/atomic.AddUint64":           0,
+	"sync/atomic.SwapInt32":           0,
+	"sync/atomic.SwapInt64":           0,
+	"sync/atomic.CompareAndSwapInt32": 0,
+	"sync/atomic.CompareAndSwapInt64": 0,
+}
+
+// writtenArgs returns the index of the first argument through which call
+// stores, if the callee is one of pointerWriters.
+func writtenArgs(pass *analysis.Pass, call *ast.CallExpr) (from int, ok bool) {
+	fn, isFunc := typeutil.Callee(pass.TypesInfo, call).(*types.Func)
+	if !isFunc {
+		return 0, false
+	}
+	from, ok = pointerWriters[fn.FullName()]
+	return from, ok
+}
+
+// sliceBase strips slice expressions, so that p.Items[:0] and p.Items[i:j]
+// resolve to the p.Items they share a backing array with.
+func sliceBase(expr ast.Expr) ast.Expr {
+	for {
+		s, ok := ast.Unparen(expr).(*ast.SliceExpr)
+		if !ok {
+			return ast.Unparen(expr)
+		}
+		expr = s.X
+	}
+}
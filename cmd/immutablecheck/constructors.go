@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"path"
+	"strings"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+// constructorPatterns holds the -constructors flag: comma-separated
+// path.Match patterns of function names, e.g. "New*,build*".
+var constructorPatterns string
+
+// constructorDirective marks a function as a constructor regardless of its name.
+const constructorDirective = "immutable:constructor"
+
+// parseConstructorPatterns splits and validates the -constructors flag.
+func parseConstructorPatterns() ([]string, error) {
+	var patterns []string
+	for _, p := range strings.Split(constructorPatterns, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid -constructors pattern %q: %v", p, err)
+		}
+		patterns = append(patterns, p)
+	}
+	return patterns, nil
+}
+
+// isConstructor reports whether fn is a declared function whose name matches
+// one of patterns or whose doc comment carries //immutable:constructor.
+func isConstructor(fn *ssa.Function, patterns []string) bool {
+	decl, ok := fn.Syntax().(*ast.FuncDecl)
+	if !ok {
+		return false
+	}
+	if hasDirective(decl.Doc, constructorDirective) {
+		return true
+	}
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, decl.Name.Name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// constructorWrites returns the positions (ssa.FieldAddr.Pos) of the field
+// stores in constructors that write to an object the constructor allocates
+// and returns. Stores to any other object, such as one passed in as a
+// parameter, are not included, so a constructor cannot be used to mutate
+// unrelated objects.
+func constructorWrites(fns []*ssa.Function, patterns []string) map[token.Pos]bool {
+	allowed := make(map[token.Pos]bool)
+	for _, fn := range fns {
+		if !isConstructor(fn, patterns) {
+			continue
+		}
+
+		returned := make(map[*ssa.Alloc]bool)
+		for _, b := range fn.Blocks {
+			if ret, ok := b.Instrs[len(b.Instrs)-1].(*ssa.Return); ok {
+				for _, res := range ret.Results {
+					if alloc := returnedAlloc(res); alloc != nil {
+						returned[alloc] = true
+					}
+				}
+			}
+		}
+
+		for _, b := range fn.Blocks {
+			for _, instr := range b.Instrs {
+				store, ok := instr.(*ssa.Store)
+				if !ok {
+					continue
+				}
+				fa, ok := store.Addr.(*ssa.FieldAddr)
+				if !ok {
+					continue
+				}
+				if alloc, ok := fa.X.(*ssa.Alloc); ok && returned[alloc] && fa.Pos().IsValid() {
+					allowed[fa.Pos()] = true
+				}
+			}
+		}
+	}
+	return allowed
+}
+
+// returnedAlloc returns the allocation a return value refers to: either the
+// pointer itself (return t) or the loaded struct value (return *t, as built
+// for a local struct variable).
+func returnedAlloc(v ssa.Value) *ssa.Alloc {
+	switch v := v.(type) {
+	case *ssa.Alloc:
+		return v
+	case *ssa.UnOp:
+		if v.Op == token.MUL {
+			alloc, _ := v.X.(*ssa.Alloc)
+			return alloc
+		}
+	}
+	return nil
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"go/types"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+
+	"goci-const-check/internal/protoimmutable"
+)
+
+// descriptorEnv lists descriptor sets to load, separated by the OS path list
+// separator, in addition to those given with -descriptor.
+const descriptorEnv = "IMMUTABLECHECK_DESCRIPTOR"
+
+// defaultDescriptorPath is probed relative to the working directory when no
+// descriptor set is configured.
+const defaultDescriptorPath = "pb/descriptor/all.protos.pb"
+
+// descriptorPaths holds the -descriptor flag values.
+var descriptorPaths stringList
+
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+var protoInfoCache struct {
+	once sync.Once
+	info map[string]*protoimmutable.ImmutableFieldInfo
+	err  error
+}
+
+// loadProtoInfo loads and merges the configured descriptor sets once per
+// process. A configured descriptor that cannot be read or parsed is an error;
+// only the unconfigured default location may be absent.
+func loadProtoInfo() (map[string]*protoimmutable.ImmutableFieldInfo, error) {
+	c := &protoInfoCache
+	c.once.Do(func() {
+		paths := slices.Clone(descriptorPaths)
+		if env := os.Getenv(descriptorEnv); env != "" {
+			for _, p := range filepath.SplitList(env) {
+				if p != "" {
+					paths = append(paths, p)
+				}
+			}
+		}
+		if len(paths) == 0 {
+			if _, err := os.Stat(defaultDescriptorPath); err != nil {
+				c.info = map[string]*protoimmutable.ImmutableFieldInfo{}
+				return
+			}
+			paths = []string{defaultDescriptorPath}
+		}
+
+		c.info = make(map[string]*protoimmutable.ImmutableFieldInfo)
+		for _, path := range paths {
+			info, err := protoimmutable.LoadDescriptorSet(path)
+			if err != nil {
+				c.err = fmt.Errorf("load descriptor set %s: %v", path, err)
+				return
+			}
+			c.info = mergeProtoInfo(c.info, info)
+		}
+	})
+	return c.info, c.err
+}
+
+// mergeProtoInfo returns the union of a and b; b wins for messages present in
+// both. Neither argument is modified.
+func mergeProtoInfo(a, b map[string]*protoimmutable.ImmutableFieldInfo) map[string]*protoimmutable.ImmutableFieldInfo {
+	merged := make(map[string]*protoimmutable.ImmutableFieldInfo, len(a)+len(b))
+	for name, msg := range a {
+		merged[name] = msg
+	}
+	for name, msg := range b {
+		merged[name] = msg
+	}
+	return merged
+}
+
+// protoIndex maps generated Go struct fields back to the proto messages they
+// were generated from, so rules only apply to the exact message they were
+// declared on.
+type protoIndex struct {
+	byGoType map[goTypeKey]*protoimmutable.ImmutableFieldInfo
+	fields   map[*types.Package]map[*types.Var]*protoField
+}
+
+// protoField is an immutable field of a generated proto message.
+type protoField struct {
+	Message *protoimmutable.ImmutableFieldInfo
+	Name    string // proto field name, e.g., "teachers"
+	Deep    bool   // (deep_immutable): everything reachable is immutable too
+}
+
+type goTypeKey struct {
+	importPath string
+	name       string
+}
+
+func newProtoIndex(infos map[string]*protoimmutable.ImmutableFieldInfo) *protoIndex {
+	idx := &protoIndex{
+		byGoType: make(map[goTypeKey]*protoimmutable.ImmutableFieldInfo),
+		fields:   make(map[*types.Package]map[*types.Var]*protoField),
+	}
+	for _, info := range infos {
+		if info.GoImportPath == "" {
+			continue
+		}
+		idx.byGoType[goTypeKey{info.GoImportPath, info.GoName}] = info
+	}
+	return idx
+}
+
+// lookup returns the proto rule for field v, or nil if v is not an immutable
+// proto field.
+func (idx *protoIndex) lookup(v *types.Var) *protoField {
+	if v.Pkg() == nil {
+		return nil
+	}
+	fields, ok := idx.fields[v.Pkg()]
+	if !ok {
+		fields = idx.packageFields(v.Pkg())
+		idx.fields[v.Pkg()] = fields
+	}
+	return fields[v]
+}
+
+// packageFields resolves every immutable proto field generated into pkg.
+func (idx *protoIndex) packageFields(pkg *types.Package) map[*types.Var]*protoField {
+	fields := make(map[*types.Var]*protoField)
+	for key, info := range idx.byGoType {
+		if key.importPath != pkg.Path() {
+			continue
+		}
+		obj, ok := pkg.Scope().Lookup(key.name).(*types.TypeName)
+		if !ok || !isProtoMessage(obj.Type()) {
+			continue
+		}
+		strct, ok := obj.Type().Underlying().(*types.Struct)
+		if !ok {
+			continue
+		}
+		add := func(v *types.Var, name string) bool {
+			if !slices.Contains(info.FieldNames, name) {
+				return false
+			}
+			fields[v] = &protoField{
+				Message: info,
+				Name:    name,
+				Deep:    slices.Contains(info.DeepFieldNames, name),
+			}
+			return true
+		}
+		for i := 0; i < strct.NumFields(); i++ {
+			// Generated fields record their proto name in the struct tag;
+			// internal fields (state, sizeCache, ...) have none.
+			if name := protoimmutable.FieldName(strct.Tag(i)); name != "" {
+				add(strct.Field(i), name)
+				continue
+			}
+			// A oneof is an interface field (Kind isMsg_Kind) holding one
+			// wrapper struct per member (&Msg_Foo{Foo: ...}), whose only
+			// field carries the member's tag. Setting the oneof replaces the
+			// member that is set, so it is immutable if any member is.
+			oneof := strct.Field(i)
+			if _, ok := reflect.StructTag(strct.Tag(i)).Lookup("protobuf_oneof"); !ok {
+				continue
+			}
+			for _, wrapper := range oneofWrappers(pkg, oneof.Type()) {
+				name := protoimmutable.FieldName(wrapper.Tag(0))
+				if add(wrapper.Field(0), name) && fields[oneof] == nil {
+					add(oneof, name)
+				}
+			}
+		}
+	}
+	return fields
+}
+
+// oneofWrappers returns the wrapper structs generated into pkg for the
+// members of a oneof whose Go interface type is iface, in name order.
+func oneofWrappers(pkg *types.Package, iface types.Type) []*types.Struct {
+	it, ok := iface.Underlying().(*types.Interface)
+	if !ok || it.NumMethods() == 0 {
+		return nil
+	}
+	var wrappers []*types.Struct
+	for _, name := range pkg.Scope().Names() {
+		obj, ok := pkg.Scope().Lookup(name).(*types.TypeName)
+		if !ok || obj.IsAlias() {
+			continue
+		}
+		strct, ok := obj.Type().Underlying().(*types.Struct)
+		if ok && strct.NumFields() == 1 && types.Implements(types.NewPointer(obj.Type()), it) {
+			wrappers = append(wrappers, strct)
+		}
+	}
+	return wrappers
+}
+
+// isProtoMessage reports whether *t implements the generated ProtoReflect method.
+func isProtoMessage(t types.Type) bool {
+	mset := types.NewMethodSet(types.NewPointer(t))
+	for i := 0; i < mset.Len(); i++ {
+		if mset.At(i).Obj().Name() == "ProtoReflect" {
+			return true
+		}
+	}
+	return false
+}
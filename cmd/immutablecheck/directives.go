@@ -0,0 +1,21 @@
+package main
+
+import (
+	"go/ast"
+	"strings"
+)
+
+// hasDirective reports whether doc contains a //name directive line,
+// optionally followed by arguments, e.g. //goci:immutable.
+func hasDirective(doc *ast.CommentGroup, name string) bool {
+	if doc == nil {
+		return false
+	}
+	for _, c := range doc.List {
+		rest, ok := strings.CutPrefix(c.Text, "//"+name)
+		if ok && (rest == "" || rest[0] == ' ' || rest[0] == '\t') {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// protoPkgPath is the import path providing proto.Clone.
+const protoPkgPath = "google.golang.org/protobuf/proto"
+
+// stmtBlocks maps the statements of file that appear directly in a statement
+// list, where a declaration may be inserted before them, to the node holding
+// that list: a block, case clause or select clause.
+func stmtBlocks(file *ast.File) map[ast.Stmt]ast.Node {
+	blocks := make(map[ast.Stmt]ast.Node)
+	add := func(block ast.Node, list []ast.Stmt) {
+		for _, s := range list {
+			blocks[s] = block
+		}
+	}
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.BlockStmt:
+			add(n, n.List)
+		case *ast.CaseClause:
+			add(n, n.Body)
+		case *ast.CommClause:
+			add(n, n.Body)
+		}
+		return true
+	})
+	return blocks
+}
+
+// fixState is shared by the suggested fixes of one package, so that they can
+// be applied together.
+type fixState struct {
+	taken  map[*types.Scope]map[string]bool // variables introduced, by scope
+	copied map[*types.Var][]ast.Node        // blocks whose uses of a variable were moved to a copy
+	uses   map[*types.Var][]*ast.Ident
+}
+
+func newFixState(pass *analysis.Pass) *fixState {
+	s := &fixState{
+		taken:  make(map[*types.Scope]map[string]bool),
+		copied: make(map[*types.Var][]ast.Node),
+		uses:   make(map[*types.Var][]*ast.Ident),
+	}
+	for id, obj := range pass.TypesInfo.Uses {
+		if v, ok := obj.(*types.Var); ok && !v.IsField() {
+			s.uses[v] = append(s.uses[v], id)
+		}
+	}
+	return s
+}
+
+// cloneFix returns a fix rewriting stmt, an assignment x.F = rhs to an
+// immutable field of the proto message *x, into a change to a copy held in a
+// new variable, which the rest of block then uses instead of x:
+//
+//	xCopy := proto.Clone(x).(*pb.T)
+//	xCopy.F = rhs
+//	... xCopy ...
+//
+// Later writes to x in block thus change the same copy and get no fix of
+// their own. The fix must not change what the function observes, so it is
+// only offered if x is a local variable or parameter that is not used after
+// block, is not a named result, is neither captured by a function literal
+// nor addressed, and before stmt only has fields read or getters called;
+// stmt must not repeat in a loop that x outlives.
+//
+// It returns nil where these do not hold or the rewrite is not mechanical:
+// the statement cannot be preceded by a declaration, or the names involved
+// are not available in file.
+func cloneFix(pass *analysis.Pass, file *ast.File, stmt *ast.AssignStmt, block ast.Node, state *fixState) *analysis.SuggestedFix {
+	if stmt.Tok != token.ASSIGN || len(stmt.Lhs) != 1 || len(stmt.Rhs) != 1 {
+		return nil
+	}
+	sel, ok := stmt.Lhs[0].(*ast.SelectorExpr)
+	if !ok {
+		return nil
+	}
+	x, ok := sel.X.(*ast.Ident)
+	if !ok {
+		return nil
+	}
+	obj, ok := pass.TypesInfo.Uses[x].(*types.Var)
+	if !ok || obj.IsField() || obj.Parent() == nil || obj.Parent() == obj.Pkg().Scope() {
+		return nil // only local variables
+	}
+	ptr, ok := obj.Type().(*types.Pointer)
+	if !ok || !isProtoMessage(ptr.Elem()) {
+		return nil
+	}
+	for _, b := range state.copied[obj] {
+		if b.Pos() <= stmt.Pos() && stmt.End() <= b.End() {
+			return nil // x already refers to a copy here
+		}
+	}
+	later, ok := copyableUses(pass, file, stmt, block, obj, state.uses[obj])
+	if !ok {
+		return nil
+	}
+
+	// Names as seen from file: the message type and the proto package.
+	typeName, ok := qualifiedTypeName(pass, file, ptr)
+	if !ok {
+		return nil
+	}
+	protoName, importEdit, ok := importName(file, protoPkgPath, "proto")
+	if !ok {
+		return nil
+	}
+
+	tf := pass.Fset.File(stmt.Pos())
+	src, err := pass.ReadFile(tf.Name())
+	if err != nil {
+		return nil
+	}
+	lineStart := tf.Offset(tf.LineStart(tf.Line(stmt.Pos())))
+	indent := src[lineStart:tf.Offset(stmt.Pos())]
+	if len(bytes.TrimLeft(indent, " \t")) != 0 {
+		return nil // something else precedes the statement on its line
+	}
+	rhs := src[tf.Offset(stmt.Rhs[0].Pos()):tf.Offset(stmt.Rhs[0].End())]
+
+	var laterPos []token.Pos
+	for _, id := range later {
+		laterPos = append(laterPos, id.Pos())
+	}
+	copyName, ok := freshName(pass, stmt.Pos(), lowerFirst(x.Name)+"Copy", state.taken, laterPos...)
+	if !ok {
+		return nil
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s := %s.Clone(%s).(%s)\n", copyName, protoName, x.Name, typeName)
+	fmt.Fprintf(&buf, "%s%s.%s = %s", indent, copyName, sel.Sel.Name, rhs)
+
+	edits := []analysis.TextEdit{{Pos: stmt.Pos(), End: stmt.End(), NewText: buf.Bytes()}}
+	for _, id := range later {
+		edits = append(edits, analysis.TextEdit{Pos: id.Pos(), End: id.End(), NewText: []byte(copyName)})
+	}
+	if importEdit != nil {
+		edits = append(edits, *importEdit)
+	}
+	state.copied[obj] = append(state.copied[obj], block)
+	return &analysis.SuggestedFix{
+		Message:   fmt.Sprintf("Change a proto.Clone copy of %s instead", x.Name),
+		TextEdits: edits,
+	}
+}
+
+// copyableUses returns the uses of the variable obj after stmt, which a
+// clone fix renames to the copy. ok is false if replacing obj by a copy from
+// stmt on in block may change the behavior of the function (see cloneFix).
+func copyableUses(pass *analysis.Pass, file *ast.File, stmt *ast.AssignStmt, block ast.Node, obj *types.Var, uses []*ast.Ident) (later []*ast.Ident, ok bool) {
+	// The statement runs once per lifetime of x: it is neither in a loop
+	// nor in a function literal that x outlives.
+	path, _ := astutil.PathEnclosingInterval(file, stmt.Pos(), stmt.End())
+	for _, n := range path {
+		if n.Pos() <= obj.Pos() && obj.Pos() < n.End() {
+			break
+		}
+		switch n.(type) {
+		case *ast.ForStmt, *ast.RangeStmt, *ast.FuncLit:
+			return nil, false
+		}
+	}
+	// Named results are read by bare returns.
+	declPath, _ := astutil.PathEnclosingInterval(file, obj.Pos(), obj.Pos())
+	for _, n := range declPath {
+		if ft, ok := n.(*ast.FuncType); ok && ft.Results != nil && ft.Results.Pos() <= obj.Pos() && obj.Pos() < ft.Results.End() {
+			return nil, false
+		}
+	}
+
+	for _, id := range uses {
+		if id == stmt.Lhs[0].(*ast.SelectorExpr).X {
+			continue
+		}
+		path, _ := astutil.PathEnclosingInterval(file, id.Pos(), id.End())
+		for _, n := range path {
+			if n.Pos() <= obj.Pos() && obj.Pos() < n.End() {
+				break
+			}
+			if _, ok := n.(*ast.FuncLit); ok {
+				return nil, false // captured
+			}
+		}
+		if len(path) > 1 {
+			if u, ok := path[1].(*ast.UnaryExpr); ok && u.Op == token.AND {
+				return nil, false // &x
+			}
+		}
+		switch {
+		case id.Pos() >= stmt.End():
+			if id.End() > block.End() {
+				return nil, false // read after the block, which keeps x
+			}
+			later = append(later, id)
+		case !readsField(pass, path):
+			return nil, false // x may have been shared before stmt
+		}
+	}
+	return later, true
+}
+
+// readsField reports whether the identifier at path[0] is x in x.F or in a
+// getter call x.GetF().
+func readsField(pass *analysis.Pass, path []ast.Node) bool {
+	if len(path) < 2 {
+		return false
+	}
+	sel, ok := path[1].(*ast.SelectorExpr)
+	if !ok || sel.X != path[0] {
+		return false
+	}
+	selection := pass.TypesInfo.Selections[sel]
+	if selection == nil {
+		return false
+	}
+	switch selection.Kind() {
+	case types.FieldVal:
+		return true
+	case types.MethodVal:
+		return strings.HasPrefix(sel.Sel.Name, "Get")
+	}
+	return false
+}
+
+// qualifiedTypeName returns the source text naming t in file, e.g. *pb.School.
+// ok is false if the package declaring t is not imported by file.
+func qualifiedTypeName(pass *analysis.Pass, file *ast.File, t types.Type) (name string, ok bool) {
+	ok = true
+	name = types.TypeString(t, func(pkg *types.Package) string {
+		if pkg == pass.Pkg {
+			return ""
+		}
+		for _, spec := range file.Imports {
+			if path, _ := strconv.Unquote(spec.Path.Value); path == pkg.Path() {
+				if spec.Name != nil {
+					return spec.Name.Name
+				}
+				return pkg.Name()
+			}
+		}
+		ok = false
+		return pkg.Name()
+	})
+	return name, ok
+}
+
+// importName returns the name under which file refers to the package path,
+// adding an import of it as name if there is none. ok is false if name is
+// already taken by another import.
+func importName(file *ast.File, path, name string) (local string, edit *analysis.TextEdit, ok bool) {
+	for _, spec := range file.Imports {
+		p, _ := strconv.Unquote(spec.Path.Value)
+		local := p[strings.LastIndexByte(p, '/')+1:]
+		if spec.Name != nil {
+			local = spec.Name.Name
+		}
+		if p == path && local != "_" && local != "." {
+			return local, nil, true
+		}
+		if local == name {
+			return "", nil, false
+		}
+	}
+
+	imp := strconv.Quote(path)
+	for _, decl := range file.Decls {
+		if gd, ok := decl.(*ast.GenDecl); ok && gd.Tok == token.IMPORT && gd.Lparen.IsValid() {
+			return name, &analysis.TextEdit{Pos: gd.Rparen, End: gd.Rparen, NewText: []byte("\t" + imp + "\n")}, true
+		}
+	}
+	return name, &analysis.TextEdit{Pos: file.Name.End(), End: file.Name.End(), NewText: []byte("\n\nimport " + imp)}, true
+}
+
+// freshName returns base, or base followed by a number, such that it can be
+// declared at pos and refers to that declaration at each of the positions
+// uses: it is declared neither in the scope enclosing pos nor, at any of
+// the positions, in a scope enclosing it, and it is not taken in the scope
+// enclosing pos. The name is recorded as taken. ok is false if pos is not
+// inside the package's files.
+func freshName(pass *analysis.Pass, pos token.Pos, base string, taken map[*types.Scope]map[string]bool, uses ...token.Pos) (name string, ok bool) {
+	scope := pass.Pkg.Scope().Innermost(pos)
+	if scope == nil {
+		return "", false
+	}
+	available := func(name string) bool {
+		if scope.Lookup(name) != nil || taken[scope][name] {
+			return false
+		}
+		if _, obj := scope.LookupParent(name, pos); obj != nil {
+			return false
+		}
+		for _, p := range uses {
+			if _, obj := pass.Pkg.Scope().Innermost(p).LookupParent(name, p); obj != nil {
+				return false
+			}
+		}
+		return true
+	}
+	name = base
+	for i := 2; !available(name); i++ {
+		name = base + strconv.Itoa(i)
+	}
+	if taken[scope] == nil {
+		taken[scope] = make(map[string]bool)
+	}
+	taken[scope][name] = true
+	return name, true
+}
+
+func lowerFirst(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	return string(unicode.ToLower(r)) + s[size:]
+}
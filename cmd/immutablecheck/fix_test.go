@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"goci-const-check/pb"
+
+	"golang.org/x/tools/go/analysis/analysistest"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// writeCloneFixDescriptor writes a descriptor set declaring the message of
+// testdata/src/clonefix with an immutable id field and returns its path.
+func writeCloneFixDescriptor(t *testing.T) string {
+	t.Helper()
+	idOpts := &descriptorpb.FieldOptions{}
+	proto.SetExtension(idOpts, pb.E_Immutable, true)
+	file := &descriptorpb.FileDescriptorProto{
+		Name:       proto.String("clonefix.proto"),
+		Package:    proto.String("clonefix"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"immutable_options.proto"},
+		Options:    &descriptorpb.FileOptions{GoPackage: proto.String("clonefix")},
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Account"),
+			Field: []*descriptorpb.FieldDescriptorProto{{
+				Name:    proto.String("id"),
+				Number:  proto.Int32(1),
+				Label:   descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+				Type:    descriptorpb.FieldDescriptorProto_TYPE_INT64.Enum(),
+				Options: idOpts,
+			}, {
+				Name:   proto.String("name"),
+				Number: proto.Int32(2),
+				Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+				Type:   descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+			}},
+		}},
+	}
+	fds := &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{
+		protodesc.ToFileDescriptorProto(descriptorpb.File_google_protobuf_descriptor_proto),
+		protodesc.ToFileDescriptorProto(pb.File_immutable_options_proto),
+		file,
+	}}
+	data, err := proto.Marshal(fds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "clonefix.pb")
+	if err := os.WriteFile(path, data, 0o666); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCloneFix(t *testing.T) {
+	resetProtoInfo := func() {
+		protoInfoCache.once = sync.Once{}
+		protoInfoCache.info, protoInfoCache.err = nil, nil
+	}
+	resetProtoInfo()
+	descriptorPaths = stringList{writeCloneFixDescriptor(t)}
+	t.Cleanup(func() {
+		descriptorPaths = nil
+		resetProtoInfo()
+	})
+	analysistest.RunWithSuggestedFixes(t, analysistest.TestData(), Analyzer, "clonefix")
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"go/constant"
+	"go/types"
+	"strings"
+	"sync"
+
+	"goci-const-check/internal/protoimmutable"
+
+	"golang.org/x/tools/go/analysis"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// fromGenerated enables reading immutable options from the raw descriptors
+// that protoc-gen-go embeds in generated packages.
+var fromGenerated bool
+
+// rawDescCache holds the file descriptors embedded in each package, keyed by
+// import path, so every package is decoded once per process.
+var rawDescCache struct {
+	mu    sync.Mutex
+	files map[string][]*descriptorpb.FileDescriptorProto
+}
+
+// loadGeneratedInfo collects immutable options from the file descriptors
+// embedded in pass.Pkg and every package it imports, directly or indirectly.
+//
+// protoc-gen-go (v1.36 and later) emits each descriptor as an unexported
+// string constant named file_<path>_proto_rawDesc; its value is available from
+// the type-checked package, so no separate descriptor set has to be built.
+func loadGeneratedInfo(pass *analysis.Pass) (map[string]*protoimmutable.ImmutableFieldInfo, error) {
+	fds := &descriptorpb.FileDescriptorSet{}
+	seen := make(map[string]bool) // proto file names
+	visited := make(map[*types.Package]bool)
+
+	var visit func(pkg *types.Package) error
+	visit = func(pkg *types.Package) error {
+		if visited[pkg] {
+			return nil
+		}
+		visited[pkg] = true
+		files, err := embeddedFiles(pkg)
+		if err != nil {
+			return err
+		}
+		for _, fd := range files {
+			if !seen[fd.GetName()] {
+				seen[fd.GetName()] = true
+				fds.File = append(fds.File, fd)
+			}
+		}
+		for _, imp := range pkg.Imports() {
+			if err := visit(imp); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := visit(pass.Pkg); err != nil {
+		return nil, err
+	}
+
+	if len(fds.File) == 0 {
+		return nil, nil
+	}
+	return protoimmutable.FromDescriptorSet(fds)
+}
+
+// embeddedFiles decodes the raw descriptor constants declared in pkg.
+func embeddedFiles(pkg *types.Package) ([]*descriptorpb.FileDescriptorProto, error) {
+	c := &rawDescCache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if files, ok := c.files[pkg.Path()]; ok {
+		return files, nil
+	}
+
+	var files []*descriptorpb.FileDescriptorProto
+	scope := pkg.Scope()
+	for _, name := range scope.Names() {
+		if !strings.HasPrefix(name, "file_") || !strings.HasSuffix(name, "_rawDesc") {
+			continue
+		}
+		k, ok := scope.Lookup(name).(*types.Const)
+		if !ok || k.Val().Kind() != constant.String {
+			continue
+		}
+		fd := new(descriptorpb.FileDescriptorProto)
+		if err := proto.Unmarshal([]byte(constant.StringVal(k.Val())), fd); err != nil {
+			return nil, fmt.Errorf("%s.%s: decode embedded descriptor: %v", pkg.Path(), name, err)
+		}
+		// Generated code lives at its go_package; fall back to the package
+		// path when the option was supplied on the protoc command line.
+		if fd.GetOptions().GetGoPackage() == "" {
+			if fd.Options == nil {
+				fd.Options = new(descriptorpb.FileOptions)
+			}
+			fd.Options.GoPackage = proto.String(pkg.Path())
+		}
+		files = append(files, fd)
+	}
+
+	if c.files == nil {
+		c.files = make(map[string][]*descriptorpb.FileDescriptorProto)
+	}
+	c.files[pkg.Path()] = files
+	return files, nil
+}
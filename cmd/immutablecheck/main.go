@@ -1,330 +1,716 @@
 package main
 
 import (
+	"fmt"
 	"go/ast"
+	"go/token"
 	"go/types"
 	"os"
-	"path/filepath"
+	"reflect"
+	"strconv"
 	"strings"
 
+	"goci-const-check/internal/directive"
+
 	"golang.org/x/tools/go/analysis"
 	"golang.org/x/tools/go/analysis/singlechecker"
-	"google.golang.org/protobuf/proto"
-	"google.golang.org/protobuf/types/descriptorpb"
 )
 
 var Analyzer = &analysis.Analyzer{
-	Name: "immutablefield",
-	Doc:  "report assignments to struct fields marked immutable (from proto or Go tags/comments)",
-	Run:  run,
+	Name:       "immutablefield",
+	Doc:        "report assignments to struct fields marked immutable (from proto or Go tags/comments)",
+	Run:        run,
+	FactTypes:  []analysis.Fact{new(immutableFact)},
+	ResultType: reflect.TypeOf([]*finding(nil)),
 }
 
-// ImmutableFieldInfo holds info about immutable fields from proto
-type ImmutableFieldInfo struct {
-	MessageName string   // e.g., "Person"
-	FieldNames  []string // e.g., ["id", "age"]
+// immutableFact is exported for every struct field marked immutable with a Go
+// tag or comment, so packages that use the struct see the marker regardless
+// of where the type is defined.
+type immutableFact struct {
+	Source string // "tag", "comment" or "type directive"
+	Deep   bool   // directive "deep" argument: everything reachable is immutable too
+	Reason string // directive reason="..." argument, if any
+
+	// WriteOnce allows the first write to the field of a freshly allocated
+	// object, as -writeonce does for every field.
+	WriteOnce bool
+
+	// Owner is the import path of the declaring package for fields tagged
+	// immutable:"external", which that package alone may modify; it is ""
+	// for fields no package may modify.
+	Owner string
 }
 
-// loadDescriptorSet reads the protobuf descriptor set file
-func loadDescriptorSet(path string) (map[string]*ImmutableFieldInfo, error) {
-	data, err := os.ReadFile(path)
+func (*immutableFact) AFact() {}
+
+func (f *immutableFact) String() string {
+	s := "immutable(" + f.Source
+	if f.Deep {
+		s += ", deep"
+	}
+	if f.WriteOnce {
+		s += ", writeonce"
+	}
+	if f.Owner != "" {
+		s += ", owner " + f.Owner
+	}
+	return s + ")"
+}
+
+// deepAll makes every immutable field deeply immutable.
+var deepAll bool
+
+// reportAddressOf enables reporting &field expressions that are not already
+// reported as a store through a pointer or a call argument.
+var reportAddressOf bool
+
+func init() {
+	Analyzer.Flags.Var(&descriptorPaths, "descriptor",
+		"path of a protobuf FileDescriptorSet to read immutable options from (repeatable; also $"+descriptorEnv+")")
+	Analyzer.Flags.BoolVar(&reportAddressOf, "address-of", false,
+		"report every expression taking the address of an immutable field, not only stores through it")
+	Analyzer.Flags.BoolVar(&deepAll, "deep", false,
+		"treat every immutable field as deeply immutable: also report writes to anything reachable from it")
+	Analyzer.Flags.BoolVar(&writeOnceAll, "writeonce", false,
+		"allow the first assignment to an immutable field of an object freshly allocated in the same function")
+	Analyzer.Flags.StringVar(&constructorPatterns, "constructors", "",
+		"comma-separated name patterns (e.g. New*,build*) of constructor functions that may set immutable fields of the object they return; "+
+			"functions with a //"+constructorDirective+" directive qualify too")
+	Analyzer.Flags.StringVar(&baselinePath, "baseline", "",
+		"file of accepted findings that are not reported; only new findings are")
+	Analyzer.Flags.BoolVar(&writeBaseline, "write-baseline", false,
+		"record the current findings in the -baseline file instead of reporting them")
+	Analyzer.Flags.StringVar(&outputFormat, "format", "text",
+		"output format: text, json or sarif (json and sarif include rule id, field, owner, immutability source and mutation kind)")
+	Analyzer.Flags.BoolVar(&fromGenerated, "from-generated", false,
+		"read immutable options from the descriptors embedded in imported protoc-gen-go packages")
+}
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	constructors, err := parseConstructorPatterns()
 	if err != nil {
 		return nil, err
 	}
+	if writeBaseline && baselinePath == "" {
+		return nil, fmt.Errorf("-write-baseline requires -baseline=file")
+	}
+	if baselinePath != "" {
+		if err := loadBaseline(); err != nil {
+			return nil, err
+		}
+	}
 
-	var fds descriptorpb.FileDescriptorSet
-	if err := proto.Unmarshal(data, &fds); err != nil {
+	// Load protobuf immutable info
+	protoImmutableInfo, err := loadProtoInfo()
+	if err != nil {
 		return nil, err
 	}
+	if fromGenerated {
+		generated, err := loadGeneratedInfo(pass)
+		if err != nil {
+			return nil, err
+		}
+		protoImmutableInfo = mergeProtoInfo(protoImmutableInfo, generated)
+	}
+	protoFields := newProtoIndex(protoImmutableInfo)
 
-	result := make(map[string]*ImmutableFieldInfo)
-
-	// Look for the custom immutable option (59527)
-	for _, fd := range fds.File {
-		for _, msg := range fd.MessageType {
-			info := &ImmutableFieldInfo{
-				MessageName: msg.GetName(),
-				FieldNames:  []string{},
+	// Check struct definitions in current files for Go tags/comments
+	for _, f := range pass.Files {
+		ast.Inspect(f, func(n ast.Node) bool {
+			gd, ok := n.(*ast.GenDecl)
+			if !ok || gd.Tok != token.TYPE {
+				return true
 			}
-
-			for _, field := range msg.Field {
-				if field.Options != nil {
-					// Check if field has the immutable option
-					// The option is encoded in the raw bytes
-					optBytes, _ := proto.Marshal(field.Options)
-
-					// Check for field number 59527 (0xE887 * 8 + 1 = wire format)
-					// The encoding for option 59527 with value 1 is: [184 136 29 1]
-					// This is wire format: (59527 << 3) | 1 (varint), then varint value 1
-					// 59527 = 0xE887
-					// 0xE887 << 3 | 1 = 0xE8871 = wire format bytes
-
-					// Simpler approach: check if the bytes contain the expected pattern
-					if len(optBytes) >= 4 && optBytes[0] == 184 && optBytes[1] == 136 && optBytes[2] == 29 && optBytes[3] == 1 {
-						info.FieldNames = append(info.FieldNames, field.GetName())
-					}
+			for _, spec := range gd.Specs {
+				ts := spec.(*ast.TypeSpec)
+				doc := ts.Doc
+				if doc == nil && len(gd.Specs) == 1 {
+					doc = gd.Doc // type T struct{...} without parentheses
 				}
+				markStructFields(pass, ts, doc)
 			}
+			return true
+		})
+	}
 
-			if len(info.FieldNames) > 0 {
-				result[info.MessageName] = info
-			}
+	isImmutable := func(v *types.Var) bool {
+		// Facts cover markers in this package as well as in its dependencies.
+		var fact immutableFact
+		if pass.ImportObjectFact(v, &fact) {
+			return fact.Owner != pass.Pkg.Path()
 		}
+		return protoFields.lookup(v) != nil
+	}
+	isDeep := func(v *types.Var) bool {
+		if pf := protoFields.lookup(v); pf != nil && pf.Deep {
+			return true
+		}
+		var fact immutableFact
+		if pass.ImportObjectFact(v, &fact) && fact.Deep && fact.Owner != pass.Pkg.Path() {
+			return true
+		}
+		return deepAll && isImmutable(v)
 	}
 
-	return result, nil
-}
+	// fieldOrigin returns the message or type declaring field, what made the
+	// field immutable, and where that was declared.
+	fieldOrigin := func(field *types.Var) (owner, source string, related []analysis.RelatedInformation) {
+		if pf := protoFields.lookup(field); pf != nil {
+			origin := protoOrigin(field, pf)
+			return pf.Message.MessageName, "proto option " + pf.Message.Sources[pf.Name], []analysis.RelatedInformation{origin}
+		}
+		var fact immutableFact
+		if !pass.ImportObjectFact(field, &fact) {
+			return "", "", nil
+		}
+		if name := fieldOwner(field); name != "" {
+			owner = field.Pkg().Path() + "." + name
+		}
+		return owner, fact.Source, []analysis.RelatedInformation{goOrigin(pass.Fset, field, &fact)}
+	}
 
-func run(pass *analysis.Pass) (interface{}, error) {
-	// Load protobuf immutable info
-	protoImmutableInfo := make(map[string]*ImmutableFieldInfo)
-	possiblePaths := []string{
-		"pb/descriptor/all.protos.pb",
-		"./pb/descriptor/all.protos.pb",
-		filepath.Join(pass.Pkg.Path(), "../../pb/descriptor/all.protos.pb"),
-		filepath.Join(pass.Pkg.Path(), "../pb/descriptor/all.protos.pb"),
-		filepath.Join(pass.Pkg.Path(), "pb/descriptor/all.protos.pb"),
-	}
-
-	for _, path := range possiblePaths {
-		if _, err := os.Stat(path); err == nil {
-			if info, err := loadDescriptorSet(path); err == nil {
-				protoImmutableInfo = info
-				break
+	// reportf reports a finding about field unless an //immutablecheck:ignore
+	// directive covers it or it is in the baseline. In -write-baseline mode
+	// findings are recorded instead of reported.
+	ignores := collectSuppressions(pass)
+	var baseline map[baselineKey]int
+	var recorded []baselineKey
+	if baselinePath != "" {
+		baseline = baselineEntries(pass.Pkg.Path())
+	}
+	var findings []*finding
+	reportFixf := func(pos token.Pos, field *types.Var, fix *analysis.SuggestedFix, rule, kind string, format string, args ...interface{}) {
+		if ignores.suppressed(pos) {
+			return
+		}
+		if baselinePath != "" {
+			key := findingKey(pass, pos, field)
+			if writeBaseline {
+				recorded = append(recorded, key)
+				return
+			}
+			if baseline[key] > 0 {
+				baseline[key]--
+				return
 			}
 		}
+		f := &finding{
+			Rule:    rule,
+			Message: fmt.Sprintf(format, args...),
+			Pos:     pass.Fset.Position(pos),
+			Field:   field.Name(),
+			Kind:    kind,
+		}
+		var related []analysis.RelatedInformation
+		f.Owner, f.Source, related = fieldOrigin(field)
+		if len(related) > 0 {
+			f.Origin = related[0].Message
+		}
+		findings = append(findings, f)
+		d := analysis.Diagnostic{Pos: pos, Category: rule, Message: f.Message, Related: related}
+		if fix != nil {
+			d.SuggestedFixes = []analysis.SuggestedFix{*fix}
+		}
+		pass.Report(d)
+	}
+	reportf := func(pos token.Pos, field *types.Var, rule, kind string, format string, args ...interface{}) {
+		reportFixf(pos, field, nil, rule, kind, format, args...)
 	}
 
-	// Build a map of field -> immutable status
-	immutableFields := make(map[*types.Var]bool)
-
-	// Check all defined types in this package
-	scope := pass.Pkg.Scope()
-	for _, name := range scope.Names() {
-		obj := scope.Lookup(name)
-		if obj == nil {
-			continue
+	// reportDeep reports a write to expr if expr is reachable from a deeply
+	// immutable field, and reports whether it did.
+	reportDeep := func(expr ast.Expr, kind string) bool {
+		root := deepRoot(pass, expr, isDeep)
+		if root == nil {
+			return false
 		}
+		reportf(expr.Pos(), root, ruleDeep, kind, "modifying %s, reachable from deep-immutable field %s (%s)",
+			types.ExprString(expr), root.Name(), kind)
+		return true
+	}
 
-		named, ok := obj.Type().(*types.Named)
-		if !ok {
-			continue
+	// Field stores inside constructors and first writes, keyed by the
+	// position of the selected field. They need SSA, which is built on the
+	// first assignment to an immutable field, so packages without any are
+	// never built.
+	var constructorInits, initialWrites, cloneWrites map[token.Pos]bool
+
+	// allowedWrite reports whether the plain assignment to field v selected
+	// by sel is permitted: a constructor initialising its result, the first
+	// change to a proto.Clone copy, or the first write to a write-once field.
+	allowedWrite := func(sel *ast.SelectorExpr, v *types.Var) bool {
+		if constructorInits == nil {
+			srcFuncs := buildSSA(pass)
+			constructorInits = constructorWrites(srcFuncs, constructors)
+			initialWrites = firstWrites(srcFuncs, isAlloc)
+			cloneWrites = firstWrites(srcFuncs, isClone)
 		}
-		strct, ok := named.Underlying().(*types.Struct)
-		if !ok {
-			continue
+		pos := sel.Sel.Pos()
+		if constructorInits[pos] || cloneWrites[pos] {
+			return true
 		}
+		var fact immutableFact
+		writeOnce := writeOnceAll || pass.ImportObjectFact(v, &fact) && fact.WriteOnce
+		return writeOnce && initialWrites[pos]
+	}
 
-		// Check proto definitions for this struct
-		protoInfo, hasProtoInfo := protoImmutableInfo[named.Obj().Name()]
-		if hasProtoInfo {
-			for i := 0; i < strct.NumFields(); i++ {
-				field := strct.Field(i)
-				for _, immField := range protoInfo.FieldNames {
-					if strings.EqualFold(field.Name(), immField) ||
-						strings.EqualFold(field.Name(), snakeToCamelCase(immField)) {
-						immutableFields[field] = true
-						break
-					}
-				}
-			}
+	// pointerAliases maps local variables holding the address of an immutable
+	// field (ptr := &p.Id) to that field, so stores through them are caught.
+	pointerAliases := make(map[types.Object]*types.Var)
+	// consumedAddrs holds &field expressions already reported as call arguments.
+	consumedAddrs := make(map[*ast.UnaryExpr]bool)
+
+	// reportedRHSCalls holds calls on the right-hand side of an assignment to
+	// an immutable field; the assignment is judged as a whole, so the calls
+	// are not reported a second time.
+	reportedRHSCalls := make(map[*ast.CallExpr]bool)
+
+	trackAlias := func(lhs, rhs ast.Expr) {
+		id, ok := ast.Unparen(lhs).(*ast.Ident)
+		if !ok || id.Name == "_" {
+			return
+		}
+		obj := pass.TypesInfo.ObjectOf(id)
+		if obj == nil {
+			return
+		}
+		if _, v := addressedField(pass, rhs); v != nil && isImmutable(v) {
+			pointerAliases[obj] = v
+		} else if x := addrOperand(rhs); x != nil && deepRoot(pass, x, isDeep) != nil {
+			pointerAliases[obj] = deepRoot(pass, x, isDeep)
+		} else {
+			delete(pointerAliases, obj)
 		}
 	}
 
-	// Also check struct definitions in current files for Go tags/comments
+	fixes := newFixState(pass)
+
+	// Now walk through the code looking for assignments to immutable fields
 	for _, f := range pass.Files {
+		blocks := stmtBlocks(f)
 		ast.Inspect(f, func(n ast.Node) bool {
-			ts, ok := n.(*ast.TypeSpec)
-			if !ok {
-				return true
-			}
-			st, ok := ts.Type.(*ast.StructType)
-			if !ok || st.Fields == nil {
-				return true
-			}
-
-			// Get the type object
-			obj := pass.TypesInfo.Defs[ts.Name]
-			if obj == nil {
-				return true
-			}
-			named, ok := obj.Type().(*types.Named)
-			if !ok {
-				return true
-			}
-			strct, ok := named.Underlying().(*types.Struct)
-			if !ok {
-				return true
-			}
-
-			// Check Go tags/comments for immutable fields
-			for i := 0; i < strct.NumFields(); i++ {
-				field := strct.Field(i)
-				if len(st.Fields.List) <= i {
-					continue
-				}
-				astField := st.Fields.List[i]
-
-				isImmutable := false
-
-				// Check Go tags
-				if astField.Tag != nil {
-					tagText := strings.Trim(astField.Tag.Value, "`\"")
-					if strings.Contains(tagText, `immutable:"true"`) || strings.Contains(tagText, `immutable:"1"`) {
-						isImmutable = true
+			switch stmt := n.(type) {
+			case *ast.ValueSpec:
+				if len(stmt.Names) == len(stmt.Values) {
+					for i, name := range stmt.Names {
+						trackAlias(name, stmt.Values[i])
 					}
 				}
-				// Check trailing comment
-				if !isImmutable && astField.Comment != nil {
-					for _, c := range astField.Comment.List {
-						if strings.Contains(strings.ToLower(c.Text), "immutable") {
-							isImmutable = true
-							break
+			case *ast.CallExpr:
+				if name, arg := mutatedArg(pass, stmt); arg != nil && !reportedRHSCalls[stmt] {
+					if v := fieldRef(pass, sliceBase(arg)); v != nil && isImmutable(v) {
+						if name == "append" {
+							reportf(arg.Pos(), v, ruleInPlaceCall, "call to append", "call to append may write into the backing array of immutable field %s", v.Name())
+						} else {
+							reportf(arg.Pos(), v, ruleInPlaceCall, "call to "+name, "call to %s modifies immutable field %s in place", name, v.Name())
 						}
+					} else {
+						reportDeep(sliceBase(arg), "call to "+name)
 					}
 				}
-				// Check doc comment
-				if !isImmutable && astField.Doc != nil {
-					for _, c := range astField.Doc.List {
-						if strings.Contains(strings.ToLower(c.Text), "immutable") {
-							isImmutable = true
-							break
+				// Addresses passed to other functions are only reported
+				// with -address-of, below.
+				from, writes := writtenArgs(pass, stmt)
+				for i, arg := range stmt.Args {
+					if !writes || i < from {
+						continue
+					}
+					addr, v := addressedField(pass, arg)
+					if v != nil && isImmutable(v) {
+						consumedAddrs[addr] = true
+						reportf(addr.Pos(), v, ruleAddressPassed, "address passed to "+types.ExprString(stmt.Fun), "passing address of immutable field %s to %s",
+							v.Name(), types.ExprString(stmt.Fun))
+					} else if x := addrOperand(arg); x != nil {
+						if reportDeep(x, "address passed to "+types.ExprString(stmt.Fun)) {
+							consumedAddrs[ast.Unparen(arg).(*ast.UnaryExpr)] = true
 						}
 					}
 				}
-
-				if isImmutable {
-					immutableFields[field] = true
+			case *ast.UnaryExpr:
+				if reportAddressOf && !consumedAddrs[stmt] {
+					if _, v := addressedField(pass, stmt); v != nil && isImmutable(v) {
+						reportf(stmt.Pos(), v, ruleAddressOf, "address taken", "taking address of immutable field %s", v.Name())
+					}
 				}
-			}
-
-			return true
-		})
-	}
-
-	// Now walk through the code looking for assignments to immutable fields
-	for _, f := range pass.Files {
-		ast.Inspect(f, func(n ast.Node) bool {
-			switch stmt := n.(type) {
 			case *ast.AssignStmt:
+				if len(stmt.Lhs) == len(stmt.Rhs) && (stmt.Tok == token.ASSIGN || stmt.Tok == token.DEFINE) {
+					for i := range stmt.Lhs {
+						trackAlias(stmt.Lhs[i], stmt.Rhs[i])
+					}
+				}
 				for _, lhs := range stmt.Lhs {
+					reported := false
+
+					// Check store through a pointer alias:
+					if v := aliasedField(pass, pointerAliases, lhs); v != nil {
+						reported = true
+						reportf(lhs.Pos(), v, rulePointerStore, "assignment through pointer", "assignment through pointer to immutable field %s", v.Name())
+					}
+
 					// Check direct field assignment:
-					if sel, ok := lhs.(*ast.SelectorExpr); ok {
-						if selInfo, found := pass.TypesInfo.Selections[sel]; found {
-							if v, ok := selInfo.Obj().(*types.Var); ok {
-								// Get receiver type name
-								typeName := getReceiverTypeName(selInfo)
-								pkgName := v.Pkg().Name()
-
-								// Check local immutable fields
-								if immutableFields[v] {
-									pass.Reportf(sel.Pos(), "assignment to immutable field %s", v.Name())
-								} else {
-									// Check if this field is from pb package and might be immutable from proto
-									protoInfo, hasProtoInfo := protoImmutableInfo[typeName]
-									if hasProtoInfo && (pkgName == "pb" || strings.HasSuffix(v.Pkg().Path(), "/pb")) {
-										for _, immField := range protoInfo.FieldNames {
-											if strings.EqualFold(v.Name(), immField) ||
-												strings.EqualFold(v.Name(), snakeToCamelCase(immField)) {
-												pass.Reportf(sel.Pos(), "assignment to immutable field %s", v.Name())
-												break
-											}
-										}
-									}
-								}
+					if v := selectedField(pass, lhs); v != nil && isImmutable(v) {
+						reported = true
+						// p.Items = append(p.Items, x) is judged once, as the assignment.
+						for _, rhs := range stmt.Rhs {
+							if call, ok := ast.Unparen(rhs).(*ast.CallExpr); ok {
+								reportedRHSCalls[call] = true
+							}
+						}
+						switch {
+						case stmt.Tok == token.ASSIGN && allowedWrite(lhs.(*ast.SelectorExpr), v):
+							// write-once first write, a change to a fresh clone, or a
+							// constructor initialising its result
+						case stmt.Tok == token.ASSIGN:
+							var fix *analysis.SuggestedFix
+							if block := blocks[stmt]; block != nil && protoFields.lookup(v) != nil {
+								fix = cloneFix(pass, f, stmt, block, fixes)
 							}
+							reportFixf(lhs.Pos(), v, fix, ruleAssign, "assignment", "assignment to immutable field %s", v.Name())
+						default:
+							reportf(lhs.Pos(), v, ruleCompoundAssign, "compound assignment "+stmt.Tok.String(), "compound assignment %s to immutable field %s",
+								describeCompoundAssign(stmt.Tok, v.Type()), v.Name())
 						}
 					}
 
 					// Check map index assignment:
 					if idx, ok := lhs.(*ast.IndexExpr); ok {
 						// Extract the X part (the map/slice being indexed)
-						if sel, ok := idx.X.(*ast.SelectorExpr); ok {
-							if selInfo, found := pass.TypesInfo.Selections[sel]; found {
-								if v, ok := selInfo.Obj().(*types.Var); ok {
-									// Check if the field being indexed is immutable
-									typeName := getReceiverTypeName(selInfo)
-									pkgName := v.Pkg().Name()
-
-									// Check local immutable fields
-									if immutableFields[v] {
-										pass.Reportf(idx.Pos(), "modifying immutable field %s (map/slice index)", v.Name())
-									} else {
-										// Check if this field is from pb package and might be immutable from proto
-										protoInfo, hasProtoInfo := protoImmutableInfo[typeName]
-										if hasProtoInfo && (pkgName == "pb" || strings.HasSuffix(v.Pkg().Path(), "/pb")) {
-											for _, immField := range protoInfo.FieldNames {
-												if strings.EqualFold(v.Name(), immField) ||
-													strings.EqualFold(v.Name(), snakeToCamelCase(immField)) {
-													pass.Reportf(idx.Pos(), "modifying immutable field %s (map/slice index)", v.Name())
-													break
-												}
-											}
-										}
-									}
-								}
+						if v := fieldRef(pass, idx.X); v != nil && isImmutable(v) {
+							reported = true
+							if stmt.Tok == token.ASSIGN {
+								reportf(idx.Pos(), v, ruleIndex, "map/slice index assignment", "modifying immutable field %s (map/slice index)", v.Name())
+							} else {
+								reportf(idx.Pos(), v, ruleIndex, "map/slice index compound assignment "+stmt.Tok.String(), "modifying immutable field %s (map/slice index, compound assignment %s)",
+									v.Name(), describeCompoundAssign(stmt.Tok, pass.TypesInfo.TypeOf(idx)))
 							}
 						}
 					}
-				}
-			case *ast.IncDecStmt:
-				if sel, ok := stmt.X.(*ast.SelectorExpr); ok {
-					if selInfo, found := pass.TypesInfo.Selections[sel]; found {
-						if v, ok := selInfo.Obj().(*types.Var); ok {
-							// Get receiver type name
-							typeName := getReceiverTypeName(selInfo)
-							pkgName := v.Pkg().Name()
-
-							// Check local immutable fields
-							if immutableFields[v] {
-								pass.Reportf(sel.Pos(), "modifying immutable field %s (inc/dec)", v.Name())
-							}
 
-							// Check if this field is from pb package and might be immutable from proto
-							protoInfo, hasProtoInfo := protoImmutableInfo[typeName]
-							if hasProtoInfo && (pkgName == "pb" || strings.HasSuffix(v.Pkg().Path(), "/pb")) {
-								for _, immField := range protoInfo.FieldNames {
-									if strings.EqualFold(v.Name(), immField) ||
-										strings.EqualFold(v.Name(), snakeToCamelCase(immField)) {
-										pass.Reportf(sel.Pos(), "modifying immutable field %s (inc/dec)", v.Name())
-										break
-									}
-								}
-							}
+					// Check writes anywhere below a deeply immutable field:
+					if !reported {
+						kind := "assignment"
+						if stmt.Tok != token.ASSIGN && stmt.Tok != token.DEFINE {
+							kind = "compound assignment " + stmt.Tok.String()
 						}
+						reportDeep(lhs, kind)
 					}
 				}
+			case *ast.IncDecStmt:
+				if v := selectedField(pass, stmt.X); v != nil && isImmutable(v) {
+					reportf(stmt.X.Pos(), v, ruleIncDec, "inc/dec", "modifying immutable field %s (inc/dec)", v.Name())
+				} else if v := aliasedField(pass, pointerAliases, stmt.X); v != nil {
+					reportf(stmt.X.Pos(), v, ruleIncDec, "inc/dec through pointer", "modifying immutable field %s through pointer (inc/dec)", v.Name())
+				} else if idx, ok := ast.Unparen(stmt.X).(*ast.IndexExpr); ok && fieldRef(pass, idx.X) != nil && isImmutable(fieldRef(pass, idx.X)) {
+					v := fieldRef(pass, idx.X)
+					reportf(idx.Pos(), v, ruleIndex, "map/slice index inc/dec", "modifying immutable field %s (map/slice index, inc/dec)", v.Name())
+				} else {
+					reportDeep(stmt.X, "inc/dec")
+				}
 			}
 			return true
 		})
 	}
 
-	return nil, nil
+	ignores.reportUnused(pass)
+	if writeBaseline {
+		if err := recordBaseline(pass.Pkg.Path(), recorded); err != nil {
+			return nil, err
+		}
+	}
+	return findings, nil
+}
+
+// markStructFields exports an immutableFact for every field of the struct
+// type declared by ts that is marked immutable. doc is the type's doc
+// comment; a //goci:immutable directive there marks all fields but those
+// tagged immutable:"false", while a tag or comment on a field takes
+// precedence over it.
+func markStructFields(pass *analysis.Pass, ts *ast.TypeSpec, doc *ast.CommentGroup) {
+	st, ok := ts.Type.(*ast.StructType)
+	if !ok || st.Fields == nil {
+		return
+	}
+
+	wholeType := commentDirective(pass, doc, false)
+
+	// Check Go tags/comments for immutable fields. One AST field may declare
+	// several struct fields (A, B int), so the markers of each AST field
+	// apply to every name it declares.
+	for _, astField := range st.Fields.List {
+		fields := fieldVars(pass, astField)
+		if len(fields) == 0 {
+			continue
+		}
+
+		// Check Go tags; an explicit immutable:"false" wins over comments
+		// and the type directive.
+		var tag immutableTag
+		hasTag := false
+		if astField.Tag != nil {
+			tagText, _ := strconv.Unquote(astField.Tag.Value)
+			var err error
+			tag, hasTag, err = parseImmutableTag(tagText)
+			if err != nil {
+				reportRule(pass, astField.Pos(), ruleInvalidTag, "invalid immutable tag on field %s: %v", fields[0].Name(), err)
+				hasTag = false
+			}
+		}
+
+		// Check trailing and doc comments; both are always parsed so that
+		// malformed directives are reported even on tagged fields.
+		var fieldDirective *directive.Immutable
+		for _, group := range []*ast.CommentGroup{astField.Comment, astField.Doc} {
+			if d := commentDirective(pass, group, true); d != nil && fieldDirective == nil {
+				fieldDirective = d
+			}
+		}
+
+		var fact *immutableFact
+		switch {
+		case hasTag && tag.Immutable:
+			fact = &immutableFact{Source: "tag", Deep: tag.Deep, WriteOnce: tag.WriteOnce}
+			if tag.External {
+				// Writable in the declaring package only.
+				fact.Owner = pass.Pkg.Path()
+			}
+		case hasTag:
+			continue
+		case fieldDirective != nil:
+			fact = &immutableFact{Source: "comment", Deep: fieldDirective.Deep, Reason: fieldDirective.Reason}
+		case wholeType != nil:
+			fact = &immutableFact{Source: "type directive", Deep: wholeType.Deep, Reason: wholeType.Reason}
+		default:
+			continue
+		}
+		for _, field := range fields {
+			pass.ExportObjectFact(field, fact)
+		}
+	}
 }
 
-// snakeToCamelCase converts snake_case to CamelCase
-func snakeToCamelCase(s string) string {
-	parts := strings.Split(s, "_")
-	for i := range parts {
-		if len(parts[i]) > 0 {
-			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+// fieldVars returns the struct fields declared by astField: one per name, or
+// the single embedded field if it has no names.
+func fieldVars(pass *analysis.Pass, astField *ast.Field) []*types.Var {
+	idents := astField.Names
+	if len(idents) == 0 {
+		// go/types records an embedded field under the identifier of its
+		// type name: T, *T, pkg.T or a generic T[P].
+		if id := embeddedIdent(astField.Type); id != nil {
+			idents = []*ast.Ident{id}
 		}
 	}
-	return strings.Join(parts, "")
+	var fields []*types.Var
+	for _, id := range idents {
+		if v, ok := pass.TypesInfo.Defs[id].(*types.Var); ok && v.IsField() {
+			fields = append(fields, v)
+		}
+	}
+	return fields
+}
+
+// embeddedIdent returns the type name identifier of an embedded field type.
+func embeddedIdent(expr ast.Expr) *ast.Ident {
+	switch e := ast.Unparen(expr).(type) {
+	case *ast.Ident:
+		return e
+	case *ast.StarExpr:
+		return embeddedIdent(e.X)
+	case *ast.SelectorExpr:
+		return e.Sel
+	case *ast.IndexExpr:
+		return embeddedIdent(e.X)
+	case *ast.IndexListExpr:
+		return embeddedIdent(e.X)
+	}
+	return nil
 }
 
-// getReceiverTypeName gets the struct name from a field's parent type (stored in selection)
-func getReceiverTypeName(selInfo *types.Selection) string {
+// commentDirective returns the first immutability directive in group, if any,
+// and reports comments that look like a mistyped directive.
+func commentDirective(pass *analysis.Pass, group *ast.CommentGroup, allowSpace bool) *directive.Immutable {
+	if group == nil {
+		return nil
+	}
+	var found *directive.Immutable
+	for _, c := range group.List {
+		d, nearMiss := directive.ParseImmutable(c.Text, allowSpace)
+		if nearMiss != "" {
+			reportRule(pass, c.Pos(), ruleMalformedDirective, "comment is not a valid immutability directive: %s (want %s)", nearMiss, directive.Usage)
+		}
+		if d != nil && found == nil {
+			found = d
+		}
+	}
+	return found
+}
+
+// deepRoot returns the outermost deeply immutable field on the access path of
+// expr, not counting the field expr itself selects: for
+// School.Teachers.Teachers[5].Name that is School.Teachers when School's
+// Teachers field is deep. Paths are followed through field selectors,
+// generated getters, indexing, slicing and pointer indirection.
+func deepRoot(pass *analysis.Pass, expr ast.Expr, isDeep func(*types.Var) bool) *types.Var {
+	var root *types.Var
+	leaf := true
+	for e := ast.Unparen(expr); e != nil; leaf = false {
+		var v *types.Var
+		switch x := e.(type) {
+		case *ast.SelectorExpr:
+			if v = selectedField(pass, x); v == nil {
+				return root
+			}
+			e = x.X
+		case *ast.CallExpr:
+			if v = getterField(pass, x); v == nil {
+				return root
+			}
+			e = ast.Unparen(x.Fun).(*ast.SelectorExpr).X
+		case *ast.IndexExpr:
+			e = x.X
+		case *ast.SliceExpr:
+			e = x.X
+		case *ast.StarExpr:
+			e = x.X
+		default:
+			return root
+		}
+		if v != nil && !leaf && isDeep(v) {
+			root = v
+		}
+		e = ast.Unparen(e)
+	}
+	return root
+}
+
+// addrOperand returns x if expr is &x.
+func addrOperand(expr ast.Expr) ast.Expr {
+	if addr, ok := ast.Unparen(expr).(*ast.UnaryExpr); ok && addr.Op == token.AND {
+		return addr.X
+	}
+	return nil
+}
+
+// addressedField returns the &field expression and the field if expr takes
+// the address of a struct field.
+func addressedField(pass *analysis.Pass, expr ast.Expr) (*ast.UnaryExpr, *types.Var) {
+	addr, ok := ast.Unparen(expr).(*ast.UnaryExpr)
+	if !ok || addr.Op != token.AND {
+		return nil, nil
+	}
+	v := selectedField(pass, ast.Unparen(addr.X))
+	if v == nil {
+		return nil, nil
+	}
+	return addr, v
+}
+
+// aliasedField returns the immutable field that expr stores into if expr
+// dereferences a pointer alias (*ptr).
+func aliasedField(pass *analysis.Pass, aliases map[types.Object]*types.Var, expr ast.Expr) *types.Var {
+	star, ok := ast.Unparen(expr).(*ast.StarExpr)
+	if !ok {
+		return nil
+	}
+	id, ok := ast.Unparen(star.X).(*ast.Ident)
+	if !ok {
+		return nil
+	}
+	return aliases[pass.TypesInfo.ObjectOf(id)]
+}
+
+// compoundAssignOps names the operation performed by each compound
+// assignment operator.
+var compoundAssignOps = map[token.Token]string{
+	token.ADD_ASSIGN:     "addition",
+	token.SUB_ASSIGN:     "subtraction",
+	token.MUL_ASSIGN:     "multiplication",
+	token.QUO_ASSIGN:     "division",
+	token.REM_ASSIGN:     "remainder",
+	token.AND_ASSIGN:     "bitwise and",
+	token.OR_ASSIGN:      "bitwise or",
+	token.XOR_ASSIGN:     "bitwise xor",
+	token.SHL_ASSIGN:     "left shift",
+	token.SHR_ASSIGN:     "right shift",
+	token.AND_NOT_ASSIGN: "bit clear",
+}
+
+// describeCompoundAssign renders a compound assignment operator applied to an
+// operand of type t, e.g. "+= (string concatenation)".
+func describeCompoundAssign(tok token.Token, t types.Type) string {
+	op := compoundAssignOps[tok]
+	if tok == token.ADD_ASSIGN && t != nil {
+		if b, ok := t.Underlying().(*types.Basic); ok && b.Info()&types.IsString != 0 {
+			op = "string concatenation"
+		}
+	}
+	return fmt.Sprintf("%s (%s)", tok, op)
+}
+
+// fieldRef returns the struct field that expr refers to: either a field
+// selector or a call to the protoc-gen-go getter of the field (x.GetTeachers()),
+// which returns the same map, slice or message pointer.
+func fieldRef(pass *analysis.Pass, expr ast.Expr) *types.Var {
+	expr = ast.Unparen(expr)
+	if v := selectedField(pass, expr); v != nil {
+		return v
+	}
+	return getterField(pass, expr)
+}
+
+// getterField returns field X if expr is a call of the generated GetX method
+// on a proto message.
+func getterField(pass *analysis.Pass, expr ast.Expr) *types.Var {
+	call, ok := expr.(*ast.CallExpr)
+	if !ok || len(call.Args) != 0 {
+		return nil
+	}
+	sel, ok := ast.Unparen(call.Fun).(*ast.SelectorExpr)
+	if !ok {
+		return nil
+	}
+	selInfo, found := pass.TypesInfo.Selections[sel]
+	if !found || selInfo.Kind() != types.MethodVal {
+		return nil
+	}
+	name, ok := strings.CutPrefix(sel.Sel.Name, "Get")
+	if !ok || name == "" {
+		return nil
+	}
 	recv := selInfo.Recv()
 	if ptr, ok := recv.(*types.Pointer); ok {
 		recv = ptr.Elem()
 	}
-	if named, ok := recv.(*types.Named); ok {
-		return named.Obj().Name()
+	if !isProtoMessage(recv) {
+		return nil
+	}
+	obj, _, _ := types.LookupFieldOrMethod(recv, true, selInfo.Obj().Pkg(), name)
+	v, ok := obj.(*types.Var)
+	if !ok || !v.IsField() {
+		return nil
 	}
-	return ""
+	return v
+}
+
+// selectedField returns the struct field selected by expr, if expr is a field selector.
+func selectedField(pass *analysis.Pass, expr ast.Expr) *types.Var {
+	sel, ok := expr.(*ast.SelectorExpr)
+	if !ok {
+		return nil
+	}
+	selInfo, found := pass.TypesInfo.Selections[sel]
+	if !found || selInfo.Kind() != types.FieldVal {
+		return nil
+	}
+	v, _ := selInfo.Obj().(*types.Var)
+	return v
 }
 
 func main() {
+	// singlechecker only prints text; the other formats need the findings
+	// themselves and use a driver of their own.
+	if format := formatArg(os.Args[1:]); format != "" && format != "text" {
+		os.Exit(runFormatted(os.Stdout))
+	}
 	singlechecker.Main(Analyzer)
 }
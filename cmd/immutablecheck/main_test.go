@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+
+	"golang.org/x/tools/go/analysis/analysistest"
+)
+
+func TestCompoundAssign(t *testing.T) {
+	analysistest.Run(t, analysistest.TestData(), Analyzer, "compound")
+}
+
+func TestFieldLayout(t *testing.T) {
+	analysistest.Run(t, analysistest.TestData(), Analyzer, "layout")
+}
+
+func TestTypeDirective(t *testing.T) {
+	analysistest.Run(t, analysistest.TestData(), Analyzer, "wholetype")
+}
+
+func TestWriteOnce(t *testing.T) {
+	analysistest.Run(t, analysistest.TestData(), Analyzer, "writeonce")
+}
+
+func TestPointerAliases(t *testing.T) {
+	analysistest.Run(t, analysistest.TestData(), Analyzer, "pointers")
+}
+
+func TestInPlaceCalls(t *testing.T) {
+	analysistest.Run(t, analysistest.TestData(), Analyzer, "builtins")
+}
+
+func TestGetters(t *testing.T) {
+	analysistest.Run(t, analysistest.TestData(), Analyzer, "getters")
+}
+
+func TestDeep(t *testing.T) {
+	analysistest.Run(t, analysistest.TestData(), Analyzer, "deep")
+}
+
+func TestSuppressions(t *testing.T) {
+	analysistest.Run(t, analysistest.TestData(), Analyzer, "suppress")
+}
+
+func TestDirectives(t *testing.T) {
+	analysistest.Run(t, analysistest.TestData(), Analyzer, "directives")
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// protoOrigin explains an immutable proto field: where the option is
+// declared and which option it is. The related position is the generated Go
+// field, as the .proto file is not part of the file set.
+func protoOrigin(field *types.Var, pf *protoField) analysis.RelatedInformation {
+	msg := pf.Message
+	where := msg.ProtoFile
+	if line := msg.Lines[pf.Name]; line > 0 {
+		where = fmt.Sprintf("%s:%d", where, line)
+	}
+	return analysis.RelatedInformation{
+		Pos:     field.Pos(),
+		Message: fmt.Sprintf("declared immutable in %s via %s", where, msg.Sources[pf.Name]),
+	}
+}
+
+// goOrigin explains a field marked immutable in Go source by fact: the tag
+// or comment on the field, or the directive on its type.
+func goOrigin(fset *token.FileSet, field *types.Var, fact *immutableFact) analysis.RelatedInformation {
+	pos, via := field.Pos(), fact.Source
+	switch fact.Source {
+	case "type directive":
+		via = "//goci:immutable"
+		if name := fieldOwner(field); name != "" {
+			pos = field.Pkg().Scope().Lookup(name).Pos()
+			via += " on type " + name
+		}
+	case "comment":
+		via = "comment"
+	}
+	msg := fmt.Sprintf("declared immutable via %s at %s", via, relPosition(fset.Position(pos)))
+	if fact.Owner != "" {
+		msg += fmt.Sprintf(" (writable only in package %s)", fact.Owner)
+	}
+	if fact.Reason != "" {
+		msg += fmt.Sprintf("; reason: %s", fact.Reason)
+	}
+	return analysis.RelatedInformation{Pos: pos, Message: msg}
+}
+
+// relPosition formats pos as file:line with the file relative to the working
+// directory when it lies below it.
+func relPosition(pos token.Position) string {
+	return fmt.Sprintf("%s:%d", relPath(pos.Filename), pos.Line)
+}
+
+// relPath returns filename relative to the working directory, in slash form,
+// if it lies below it, and filename unchanged otherwise.
+func relPath(filename string) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return filename
+	}
+	rel, err := filepath.Rel(wd, filename)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return filename
+	}
+	return filepath.ToSlash(rel)
+}
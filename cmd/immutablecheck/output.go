@@ -0,0 +1,329 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/token"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/checker"
+	"golang.org/x/tools/go/packages"
+)
+
+// outputFormat holds the -format flag: text, json or sarif.
+var outputFormat = "text"
+
+// Rule ids, one per kind of mutation. They are the Category of every
+// diagnostic and the ruleId of SARIF results.
+const (
+	ruleAssign         = "assignment"
+	ruleCompoundAssign = "compound-assignment"
+	ruleIndex          = "index-write"
+	ruleIncDec         = "inc-dec"
+	ruleInPlaceCall    = "in-place-call"
+	ruleAddressPassed  = "address-passed"
+	ruleAddressOf      = "address-of"
+	rulePointerStore   = "pointer-store"
+	ruleDeep           = "deep-write"
+
+	// Problems with the markers and directives themselves.
+	ruleInvalidTag         = "invalid-tag"
+	ruleMalformedDirective = "malformed-directive"
+	ruleInvalidSuppression = "invalid-suppression"
+	ruleUnusedSuppression  = "unused-suppression"
+)
+
+// rules describes each rule id for SARIF consumers.
+var rules = []struct{ ID, Description string }{
+	{ruleAssign, "Assignment to an immutable field"},
+	{ruleCompoundAssign, "Compound assignment (+=, <<=, ...) to an immutable field"},
+	{ruleIndex, "Write to a map or slice element of an immutable field"},
+	{ruleIncDec, "Increment or decrement of an immutable field"},
+	{ruleInPlaceCall, "Call that modifies an immutable field in place (delete, clear, sort, append, ...)"},
+	{ruleAddressPassed, "Address of an immutable field passed to a function that writes through it (fmt.Sscan, json.Unmarshal, ...)"},
+	{ruleAddressOf, "Address of an immutable field taken (-address-of)"},
+	{rulePointerStore, "Store through a pointer to an immutable field"},
+	{ruleDeep, "Write to a value reachable from a deeply immutable field"},
+	{ruleInvalidTag, "Malformed immutable struct tag"},
+	{ruleMalformedDirective, "Comment that looks like a mistyped immutability directive"},
+	{ruleInvalidSuppression, "//immutablecheck:ignore directive without a valid reason"},
+	{ruleUnusedSuppression, "//immutablecheck:ignore directive that suppresses nothing"},
+}
+
+// reportRule reports a diagnostic that is not a mutation of a field, such as
+// a malformed marker, under the given rule id.
+func reportRule(pass *analysis.Pass, pos token.Pos, rule, format string, args ...any) {
+	pass.Report(analysis.Diagnostic{Pos: pos, Category: rule, Message: fmt.Sprintf(format, args...)})
+}
+
+// finding is a reported mutation, the result of Analyzer for a package. The
+// other diagnostics, reported with reportRule, have only Rule, Message and
+// Pos set when written by runFormatted.
+type finding struct {
+	Rule    string         `json:"rule"`
+	Message string         `json:"message"`
+	Pos     token.Position `json:"-"`
+	Field   string         `json:"field,omitempty"`
+	Owner   string         `json:"owner,omitempty"`  // proto message or Go type, e.g. "example.Person"
+	Source  string         `json:"source,omitempty"` // e.g. "proto option (example.immutable)", "tag", "comment"
+	Kind    string         `json:"kind,omitempty"`   // mutation kind, e.g. "compound assignment +="
+	Origin  string         `json:"origin,omitempty"` // where the immutability was declared
+}
+
+// jsonFinding is a finding as written by -format=json.
+type jsonFinding struct {
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+	*finding
+}
+
+// formatArg returns the value of a -format flag in args, or "" if there is
+// none. It is looked up before flag parsing because only the text format is
+// handled by singlechecker.
+func formatArg(args []string) string {
+	for i, arg := range args {
+		if arg == "--" || !strings.HasPrefix(arg, "-") {
+			break
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if name != "format" {
+			continue
+		}
+		if !hasValue && i+1 < len(args) {
+			value = args[i+1]
+		}
+		return value
+	}
+	return ""
+}
+
+// runFormatted analyzes the packages named on the command line and writes
+// every diagnostic to w as json or sarif, with the details of the finding
+// for mutations. Like singlechecker it exits with 1 on errors and 3 if
+// anything was reported.
+func runFormatted(w io.Writer) int {
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	Analyzer.Flags.VisitAll(func(f *flag.Flag) { fs.Var(f.Value, f.Name, f.Usage) })
+	tests := fs.Bool("test", true, "indicates whether test files should be analyzed, too")
+	for _, f := range unsupportedDriverFlags {
+		fs.Var(&driverFlag{boolean: f.boolean}, f.name, "not supported with -format=json or -format=sarif")
+	}
+	fs.Parse(os.Args[1:])
+	if outputFormat != "json" && outputFormat != "sarif" {
+		fmt.Fprintf(os.Stderr, "invalid -format %q: want text, json or sarif\n", outputFormat)
+		return 1
+	}
+	failed := false
+	fs.Visit(func(f *flag.Flag) {
+		if _, ok := f.Value.(*driverFlag); ok {
+			fmt.Fprintf(os.Stderr, "-%s is not supported with -format=%s\n", f.Name, outputFormat)
+			failed = true
+		}
+	})
+	if failed {
+		return 1
+	}
+
+	pkgs, err := packages.Load(&packages.Config{Mode: packages.LoadAllSyntax, Tests: *tests}, fs.Args()...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if packages.PrintErrors(pkgs) > 0 {
+		return 1
+	}
+	graph, err := checker.Analyze([]*analysis.Analyzer{Analyzer}, pkgs, nil)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	// With -test, the files of a package are analyzed again as part of its
+	// test variant; like singlechecker, report each diagnostic once.
+	type key struct {
+		pos     token.Position
+		message string
+	}
+	var findings []*finding
+	seen := make(map[key]bool)
+	for _, act := range graph.Roots {
+		if act.Err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", act.Package.PkgPath, act.Err)
+			failed = true
+			continue
+		}
+		details := make(map[key]*finding)
+		for _, f := range act.Result.([]*finding) {
+			details[key{f.Pos, f.Message}] = f
+		}
+		for _, d := range act.Diagnostics {
+			posn := act.Package.Fset.Position(d.Pos)
+			if seen[key{posn, d.Message}] {
+				continue
+			}
+			seen[key{posn, d.Message}] = true
+			f := details[key{posn, d.Message}]
+			if f == nil {
+				f = &finding{Rule: d.Category, Message: d.Message, Pos: posn}
+			}
+			findings = append(findings, f)
+		}
+	}
+	slices.SortFunc(findings, func(a, b *finding) int {
+		if c := strings.Compare(a.Pos.Filename, b.Pos.Filename); c != 0 {
+			return c
+		}
+		return a.Pos.Offset - b.Pos.Offset
+	})
+
+	if outputFormat == "json" {
+		err = writeJSON(w, findings)
+	} else {
+		err = writeSARIF(w, findings)
+	}
+	switch {
+	case err != nil:
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	case failed:
+		return 1
+	case len(findings) > 0:
+		return 3
+	}
+	return 0
+}
+
+// unsupportedDriverFlags are the flags of singlechecker that runFormatted
+// does not implement; giving one of them is an error rather than a change
+// of behavior with -format.
+var unsupportedDriverFlags = []struct {
+	name    string
+	boolean bool
+}{
+	{"fix", true},
+	{"diff", true},
+	{"json", true},
+	{"c", false},
+	{"debug", false},
+	{"flags", true},
+	{"V", false},
+	{"cpuprofile", false},
+	{"memprofile", false},
+	{"trace", false},
+}
+
+// driverFlag is the flag.Value of an unsupported driver flag.
+type driverFlag struct{ boolean bool }
+
+func (f *driverFlag) String() string   { return "" }
+func (f *driverFlag) Set(string) error { return nil }
+func (f *driverFlag) IsBoolFlag() bool { return f.boolean }
+
+func writeJSON(w io.Writer, findings []*finding) error {
+	out := make([]jsonFinding, 0, len(findings))
+	for _, f := range findings {
+		out = append(out, jsonFinding{f.Pos.Filename, f.Pos.Line, f.Pos.Column, f})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// writeSARIF writes findings as a SARIF 2.1.0 log with a single run. File
+// locations are relative to the working directory when possible.
+func writeSARIF(w io.Writer, findings []*finding) error {
+	type message struct {
+		Text string `json:"text"`
+	}
+	type rule struct {
+		ID               string  `json:"id"`
+		ShortDescription message `json:"shortDescription"`
+	}
+	type location struct {
+		PhysicalLocation struct {
+			ArtifactLocation struct {
+				URI       string `json:"uri"`
+				URIBaseID string `json:"uriBaseId,omitempty"`
+			} `json:"artifactLocation"`
+			Region struct {
+				StartLine   int `json:"startLine"`
+				StartColumn int `json:"startColumn"`
+			} `json:"region"`
+		} `json:"physicalLocation"`
+	}
+	type result struct {
+		RuleID     string            `json:"ruleId"`
+		Level      string            `json:"level"`
+		Message    message           `json:"message"`
+		Locations  []location        `json:"locations"`
+		Properties map[string]string `json:"properties,omitempty"`
+	}
+
+	var driverRules []rule
+	for _, r := range rules {
+		driverRules = append(driverRules, rule{r.ID, message{r.Description}})
+	}
+
+	results := make([]result, 0, len(findings))
+	for _, f := range findings {
+		var loc location
+		uri := relPath(f.Pos.Filename)
+		if uri != f.Pos.Filename {
+			loc.PhysicalLocation.ArtifactLocation.URIBaseID = "%SRCROOT%"
+		}
+		loc.PhysicalLocation.ArtifactLocation.URI = filepath.ToSlash(uri)
+		loc.PhysicalLocation.Region.StartLine = f.Pos.Line
+		loc.PhysicalLocation.Region.StartColumn = f.Pos.Column
+		results = append(results, result{
+			RuleID:     f.Rule,
+			Level:      "error",
+			Message:    message{f.Message},
+			Locations:  []location{loc},
+			Properties: properties(f),
+		})
+	}
+
+	log := map[string]any{
+		"$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+		"version": "2.1.0",
+		"runs": []any{map[string]any{
+			"tool": map[string]any{
+				"driver": map[string]any{
+					"name":  "immutablecheck",
+					"rules": driverRules,
+				},
+			},
+			"results": results,
+		}},
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(log)
+}
+
+// properties returns the non-empty details of f, for SARIF result properties.
+func properties(f *finding) map[string]string {
+	props := make(map[string]string)
+	for name, value := range map[string]string{
+		"field":  f.Field,
+		"owner":  f.Owner,
+		"source": f.Source,
+		"kind":   f.Kind,
+		"origin": f.Origin,
+	} {
+		if value != "" {
+			props[name] = value
+		}
+	}
+	if len(props) == 0 {
+		return nil
+	}
+	return props
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"go/ast"
+	"go/token"
+	"strings"
+
+	"goci-const-check/internal/directive"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// ignoreDirective silences findings on its line or, in a function's doc
+// comment, in the whole function:
+//
+//	//immutablecheck:ignore reason="migration backfill"
+//
+// A directive alone on its line also covers the line below it.
+const ignoreDirective = "immutablecheck:ignore"
+
+// suppression is a single ignore directive and the source range it covers.
+type suppression struct {
+	comment  *ast.Comment
+	from, to token.Pos
+	used     bool
+}
+
+// suppressions holds the ignore directives of a package.
+type suppressions struct {
+	list []*suppression
+}
+
+// collectSuppressions finds the ignore directives in the files of pass.
+// Directives without a reason="..." are reported and suppress nothing.
+func collectSuppressions(pass *analysis.Pass) *suppressions {
+	s := new(suppressions)
+	for _, f := range pass.Files {
+		tf := pass.Fset.File(f.Pos())
+		if tf == nil {
+			continue
+		}
+		src, _ := pass.ReadFile(tf.Name())
+
+		funcDocs := make(map[*ast.Comment]*ast.FuncDecl)
+		for _, decl := range f.Decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok && fn.Doc != nil {
+				for _, c := range fn.Doc.List {
+					funcDocs[c] = fn
+				}
+			}
+		}
+
+		for _, group := range f.Comments {
+			for _, c := range group.List {
+				rest, ok := strings.CutPrefix(c.Text, "//"+ignoreDirective)
+				if !ok || rest != "" && rest[0] != ' ' && rest[0] != '\t' {
+					continue
+				}
+				if !validIgnoreArgs(pass, c, rest) {
+					continue
+				}
+
+				sup := &suppression{comment: c}
+				if fn, ok := funcDocs[c]; ok {
+					sup.from, sup.to = fn.Pos(), fn.End()
+				} else {
+					line := tf.Line(c.Pos())
+					sup.from = tf.LineStart(line)
+					last := line
+					if standalone(tf, src, c) && line < tf.LineCount() {
+						last = line + 1
+					}
+					if last < tf.LineCount() {
+						sup.to = tf.LineStart(last+1) - 1
+					} else {
+						sup.to = token.Pos(tf.Base() + tf.Size())
+					}
+				}
+				s.list = append(s.list, sup)
+			}
+		}
+	}
+	return s
+}
+
+// validIgnoreArgs checks the arguments of an ignore directive: exactly one
+// non-empty reason="...".
+func validIgnoreArgs(pass *analysis.Pass, c *ast.Comment, args string) bool {
+	args = strings.TrimSpace(args)
+	value, ok := strings.CutPrefix(args, "reason=")
+	if !ok {
+		reportRule(pass, c.Pos(), ruleInvalidSuppression, `//%s needs a justification: reason="..."`, ignoreDirective)
+		return false
+	}
+	reason, rest, err := directive.UnquotePrefix(value)
+	switch {
+	case err != nil:
+		reportRule(pass, c.Pos(), ruleInvalidSuppression, "//%s reason must be a quoted string: %v", ignoreDirective, err)
+		return false
+	case strings.TrimSpace(reason) == "":
+		reportRule(pass, c.Pos(), ruleInvalidSuppression, "//%s reason must not be empty", ignoreDirective)
+		return false
+	case strings.TrimSpace(rest) != "":
+		reportRule(pass, c.Pos(), ruleInvalidSuppression, "//%s has unexpected arguments after reason: %q", ignoreDirective, strings.TrimSpace(rest))
+		return false
+	}
+	return true
+}
+
+// standalone reports whether c is the only thing on its line.
+func standalone(tf *token.File, src []byte, c *ast.Comment) bool {
+	start := tf.Offset(tf.LineStart(tf.Line(c.Pos())))
+	end := tf.Offset(c.Pos())
+	if src == nil || end > len(src) {
+		return false
+	}
+	return strings.TrimSpace(string(src[start:end])) == ""
+}
+
+// suppressed reports whether a finding at pos is covered by a directive and
+// marks that directive as used.
+func (s *suppressions) suppressed(pos token.Pos) bool {
+	found := false
+	for _, sup := range s.list {
+		if sup.from <= pos && pos <= sup.to {
+			sup.used = true
+			found = true
+		}
+	}
+	return found
+}
+
+// reportUnused reports the directives that suppressed nothing.
+func (s *suppressions) reportUnused(pass *analysis.Pass) {
+	for _, sup := range s.list {
+		if !sup.used {
+			reportRule(pass, sup.comment.Pos(), ruleUnusedSuppression, "//%s directive suppresses nothing; remove it", ignoreDirective)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// immutableTag is a parsed `immutable:"..."` struct tag:
+//
+//	value  = base | base "," options | options
+//	base   = "true" | "1" | "false" | "0"
+//	option = "deep" | "writeonce" | "external"
+//
+// Options imply true: `immutable:"external"` equals `immutable:"true,external"`.
+type immutableTag struct {
+	Immutable bool
+	Deep      bool // everything reachable from the field is immutable too
+	WriteOnce bool // the first write to a freshly allocated object is allowed
+	External  bool // only the declaring package may modify the field
+}
+
+// parseImmutableTag parses the immutable key of tag, the unquoted struct tag
+// of a field. ok reports whether the key is present.
+func parseImmutableTag(tag string) (t immutableTag, ok bool, err error) {
+	value, ok := reflect.StructTag(tag).Lookup("immutable")
+	if !ok {
+		return t, false, nil
+	}
+	if value == "" {
+		return t, true, fmt.Errorf("empty value")
+	}
+
+	elems := strings.Split(value, ",")
+	base := true
+	switch elems[0] {
+	case "true", "1":
+		elems = elems[1:]
+	case "false", "0":
+		base = false
+		elems = elems[1:]
+	}
+	for _, opt := range elems {
+		switch opt {
+		case "deep":
+			t.Deep = true
+		case "writeonce":
+			t.WriteOnce = true
+		case "external":
+			t.External = true
+		case "true", "1", "false", "0":
+			return immutableTag{}, true, fmt.Errorf("%q must come first", opt)
+		default:
+			return immutableTag{}, true, fmt.Errorf("unknown option %q (want true, 1, false or 0 followed by deep, writeonce or external)", opt)
+		}
+	}
+	if !base && len(elems) > 0 {
+		return immutableTag{}, true, fmt.Errorf("options given for a mutable field")
+	}
+	t.Immutable = base
+	return t, true, nil
+}
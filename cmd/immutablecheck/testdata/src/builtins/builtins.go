@@ -0,0 +1,29 @@
+package builtins
+
+import (
+	"maps"
+	"slices"
+	"sort"
+)
+
+type Bag struct {
+	Tags  map[string]int `immutable:"true"` // want Tags:`immutable\(tag\)`
+	Items []string       `immutable:"true"` // want Items:`immutable\(tag\)`
+	Free  []string
+}
+
+func mutate(b *Bag, src map[string]int) {
+	delete(b.Tags, "a")          // want `call to delete modifies immutable field Tags in place`
+	clear(b.Tags)                // want `call to clear modifies immutable field Tags in place`
+	copy(b.Items, []string{"x"}) // want `call to copy modifies immutable field Items in place`
+	_ = append(b.Items[:0], "y") // want `call to append may write into the backing array of immutable field Items`
+	sort.Strings(b.Items)        // want `call to sort.Strings modifies immutable field Items in place`
+	slices.Reverse(b.Items[1:])  // want `call to slices.Reverse modifies immutable field Items in place`
+	maps.Copy(b.Tags, src)       // want `call to maps.Copy modifies immutable field Tags in place`
+	b.Tags["k"] = 1              // want `modifying immutable field Tags \(map/slice index\)`
+	b.Items[0] += "!"            // want `modifying immutable field Items \(map/slice index, compound assignment \+= \(string concatenation\)\)`
+	maps.Copy(src, b.Tags)
+	copy(b.Free, b.Items)
+	sort.Strings(b.Free)
+	b.Items = append(b.Items, "z") // want `assignment to immutable field Items`
+}
@@ -0,0 +1,13 @@
+package clonefix
+
+// Account stands in for the message generated from the test descriptor, in
+// which id is immutable.
+type Account struct {
+	Id   int64  `protobuf:"varint,1,opt,name=id,proto3"`
+	Name string `protobuf:"bytes,2,opt,name=name,proto3"`
+}
+
+func (x *Account) ProtoReflect() {}
+func (x *Account) GetId() int64  { return x.Id }
+
+func keep(*Account) {}
@@ -0,0 +1,10 @@
+package clonefix
+
+func renumber(a *Account, id int64) int64 {
+	if a.GetId() == id || a.Name == "" {
+		return id
+	}
+	a.Id = id // want `assignment to immutable field Id`
+	a.Id++    // want `immutable field Id`
+	return a.Id
+}
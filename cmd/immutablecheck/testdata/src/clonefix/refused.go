@@ -0,0 +1,39 @@
+package clonefix
+
+// No fix is offered where using a copy from the assignment on could change
+// what the function observes.
+
+func inLoop(a *Account, n int) {
+	for i := 0; i < n; i++ {
+		a.Id = int64(i) // want `assignment to immutable field Id`
+	}
+}
+
+func captured(a *Account) int64 {
+	get := func() int64 { return a.GetId() }
+	a.Id = 1 // want `assignment to immutable field Id`
+	return get()
+}
+
+func addressed(a *Account) {
+	a.Id = 1 // want `assignment to immutable field Id`
+	p := &a
+	keep(*p)
+}
+
+func usedAfterBlock(a *Account, ok bool) *Account {
+	if ok {
+		a.Id = 1 // want `assignment to immutable field Id`
+	}
+	return a
+}
+
+func namedResult() (a *Account) {
+	a.Id = 1 // want `assignment to immutable field Id`
+	return
+}
+
+func sharedBefore(a *Account) {
+	keep(a)
+	a.Id = 1 // want `assignment to immutable field Id`
+}
@@ -0,0 +1,20 @@
+package compound
+
+type Counter struct {
+	Total int   `immutable:"true"` // want Total:`immutable\(tag\)`
+	Flags uint8 `immutable:"true"` // want Flags:`immutable\(tag\)`
+	// immutable
+	Name string // want Name:`immutable\(comment\)`
+	Hits int
+}
+
+func update(c *Counter) {
+	c.Total += 2  // want `compound assignment \+= \(addition\) to immutable field Total`
+	c.Total -= 1  // want `compound assignment -= \(subtraction\) to immutable field Total`
+	c.Flags <<= 1 // want `compound assignment <<= \(left shift\) to immutable field Flags`
+	c.Flags &^= 4 // want `compound assignment &\^= \(bit clear\) to immutable field Flags`
+	c.Flags |= 8  // want `compound assignment \|= \(bitwise or\) to immutable field Flags`
+	c.Name += "!" // want `compound assignment \+= \(string concatenation\) to immutable field Name`
+	c.Hits += 1
+	c.Total++ // want `immutable field Total`
+}
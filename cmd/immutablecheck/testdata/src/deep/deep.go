@@ -0,0 +1,27 @@
+package deep
+
+type Person struct {
+	Name string
+	Tags []string
+}
+
+type Team struct {
+	Members map[int]*Person
+	Lead    Person
+}
+
+type School struct {
+	Team  *Team `immutable:"deep"` // want Team:`immutable\(tag, deep\)`
+	Staff *Team `immutable:"true"` // want Staff:`immutable\(tag\)`
+}
+
+func mutate(s *School) {
+	s.Team.Members[1].Name = "x" // want `modifying s.Team.Members\[1\].Name, reachable from deep-immutable field Team \(assignment\)`
+	s.Team.Lead.Name += "!"      // want `modifying s.Team.Lead.Name, reachable from deep-immutable field Team \(compound assignment \+=\)`
+	s.Team.Lead.Tags[0] = "a"    // want `modifying s.Team.Lead.Tags\[0\], reachable from deep-immutable field Team \(assignment\)`
+	delete(s.Team.Members, 1)    // want `modifying s.Team.Members, reachable from deep-immutable field Team \(call to delete\)`
+	p := &s.Team.Lead.Name
+	*p = "y" // want `assignment through pointer to immutable field Team`
+	s.Staff.Lead.Name = "ok"
+	s.Staff.Members[2] = nil
+}
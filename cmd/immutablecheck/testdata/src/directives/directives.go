@@ -0,0 +1,45 @@
+package directives
+
+// Account mixes field comments that are directives, prose mentioning the
+// word, and directive-shaped typos.
+type Account struct {
+	// immutable
+	ID int64 // want ID:`immutable\(comment\)`
+	//goci:immutable deep reason="audit"
+	Roles []string // want Roles:`immutable\(comment, deep\)`
+
+	// Immutable after creation; see docs.
+	Created int64
+	// immutable after setup
+	Owner string
+	// NOT immutable, callers may change this
+	Notes string
+	// immutable.
+	Region string
+
+	/* want `malformed directive name "Immutable"` */ //Immutable
+	A                                                 int
+	/* want `misspelled directive name "immutible"` */ // immutible
+	B                                                  int
+	/* want `unknown namespace "gcoi"` */ // gcoi:immutable
+	C                                     int
+	/* want `malformed directive name "GOCI:IMMUTABLE"` */ // GOCI:IMMUTABLE
+	D                                                      int
+	/* want `unknown argument "depp"` */ //goci:immutable depp
+	E                                    []int
+	/* want `unknown argument "dep"` */ // immutable dep
+	F                                   []int
+	/* want `reason must be a quoted string` */ // immutable reason=audit
+	G                                           int
+}
+
+func update(a *Account) {
+	a.ID = 1      // want `assignment to immutable field ID`
+	a.Roles = nil // want `assignment to immutable field Roles`
+	a.Created = 1
+	a.Owner = ""
+	a.Notes = ""
+	a.Region = ""
+	a.A, a.B, a.C, a.D = 1, 1, 1, 1
+	a.E, a.F, a.G = nil, nil, 1
+}
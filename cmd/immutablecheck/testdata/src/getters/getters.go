@@ -0,0 +1,32 @@
+package getters
+
+// Msg stands in for a generated proto message: getters are recognized on
+// types with a ProtoReflect method.
+type Msg struct {
+	Labels map[string]string `immutable:"true"` // want Labels:`immutable\(tag\)`
+	Items  []int             `immutable:"true"` // want Items:`immutable\(tag\)`
+	Notes  []int
+}
+
+func (m *Msg) ProtoReflect()                {}
+func (m *Msg) GetLabels() map[string]string { return m.Labels }
+func (m *Msg) GetItems() []int              { return m.Items }
+func (m *Msg) GetNotes() []int              { return m.Notes }
+
+// Plain is not a message, so its getters are ordinary methods.
+type Plain struct {
+	Items []int `immutable:"true"` // want Items:`immutable\(tag\)`
+}
+
+func (p *Plain) GetItems() []int { return p.Items }
+
+func mutate(m *Msg, p *Plain) {
+	m.GetLabels()["k"] = "v"   // want `modifying immutable field Labels \(map/slice index\)`
+	delete(m.GetLabels(), "k") // want `call to delete modifies immutable field Labels in place`
+	m.GetItems()[0]++          // want `modifying immutable field Items \(map/slice index, inc/dec\)`
+	m.Items[1]--               // want `modifying immutable field Items \(map/slice index, inc/dec\)`
+	clear(m.GetItems())        // want `call to clear modifies immutable field Items in place`
+	m.GetNotes()[0] = 1
+	p.GetItems()[0] = 1
+	_ = m.GetItems()[0]
+}
@@ -0,0 +1,39 @@
+package layout
+
+import "other"
+
+type Base struct{ V int }
+
+type Ptr struct{ V int }
+
+// Record mixes lines declaring several fields with embedded fields, so the
+// position of a field line differs from the index of the fields it declares.
+type Record struct {
+	// immutable
+	A, B int // want A:`immutable\(comment\)` B:`immutable\(comment\)`
+	C    int
+	D    int `immutable:"true"` // want D:`immutable\(tag\)`
+	// immutable
+	Base      // want Base:`immutable\(comment\)`
+	E         int
+	*Ptr      `immutable:"true"` // want Ptr:`immutable\(tag\)`
+	F         int
+	other.Ext `immutable:"true"` // want Ext:`immutable\(tag\)`
+	G         int
+	// immutable
+	H int // want H:`immutable\(comment\)`
+}
+
+func update(r *Record) {
+	r.A = 1 // want `assignment to immutable field A`
+	r.B = 1 // want `assignment to immutable field B`
+	r.C = 1
+	r.D = 1         // want `assignment to immutable field D`
+	r.Base = Base{} // want `assignment to immutable field Base`
+	r.E = 1
+	r.Ptr = nil // want `assignment to immutable field Ptr`
+	r.F = 1
+	r.Ext = other.Ext{} // want `assignment to immutable field Ext`
+	r.G = 1
+	r.H = 1 // want `assignment to immutable field H`
+}
@@ -0,0 +1,30 @@
+package pointers
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+type Rec struct {
+	ID   int64 `immutable:"true"` // want ID:`immutable\(tag\)`
+	Name string
+}
+
+func aliases(r *Rec) {
+	p := &r.ID
+	*p = 5 // want `assignment through pointer to immutable field ID`
+	*p++   // want `modifying immutable field ID through pointer \(inc/dec\)`
+	q := &r.Name
+	*q = "x"
+	var s = &r.ID
+	*s += 1 // want `assignment through pointer to immutable field ID`
+	s = new(int64)
+	*s = 2
+}
+
+func calls(r *Rec, data []byte) {
+	fmt.Sscan("42", &r.ID)      // want `passing address of immutable field ID to fmt.Sscan`
+	json.Unmarshal(data, &r.ID) // want `passing address of immutable field ID to json.Unmarshal`
+	fmt.Println(&r.ID)
+	fmt.Sscan("x", &r.Name)
+}
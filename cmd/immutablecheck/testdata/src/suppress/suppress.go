@@ -0,0 +1,46 @@
+package suppress
+
+type Rec struct {
+	ID int `immutable:"true"` // want ID:`immutable\(tag\)`
+}
+
+func trailing(r *Rec) {
+	r.ID = 1 //immutablecheck:ignore reason="trailing covers its own line"
+	r.ID = 2 // want `assignment to immutable field ID`
+}
+
+func standalone(r *Rec) {
+	//immutablecheck:ignore reason="standalone covers the next line"
+	r.ID = 1
+	r.ID = 2 // want `assignment to immutable field ID`
+}
+
+// whole is exempt as a whole.
+//
+//immutablecheck:ignore reason="function doc covers the body"
+func whole(r *Rec) {
+	r.ID = 1
+	r.ID++
+}
+
+// The expectations precede the directives, which must end the line.
+
+func missingReason(r *Rec) {
+	r.ID = 1 /* want `assignment to immutable field ID` `//immutablecheck:ignore needs a justification: reason="..."` */ //immutablecheck:ignore
+}
+
+func emptyReason(r *Rec) {
+	r.ID = 1 /* want `assignment to immutable field ID` `//immutablecheck:ignore reason must not be empty` */ //immutablecheck:ignore reason=""
+}
+
+func unquoted(r *Rec) {
+	r.ID = 1 /* want `assignment to immutable field ID` `//immutablecheck:ignore reason must be a quoted string` */ //immutablecheck:ignore reason=legacy
+}
+
+func extra(r *Rec) {
+	r.ID = 1 /* want `assignment to immutable field ID` `//immutablecheck:ignore has unexpected arguments after reason: "later"` */ //immutablecheck:ignore reason="x" later
+}
+
+func unused(r *Rec) {
+	_ = r.ID /* want `^//immutablecheck:ignore directive suppresses nothing; remove it$` */ //immutablecheck:ignore reason="nothing to suppress"
+}
@@ -0,0 +1,19 @@
+package wholetype
+
+// Point is a value object.
+//
+//goci:immutable
+type Point struct {
+	X, Y  int      // want X:`immutable\(type directive\)` Y:`immutable\(type directive\)`
+	Label string   `immutable:"false"`
+	Tags  []string `immutable:"deep"`      // want Tags:`immutable\(tag, deep\)`
+	Seq   int      `immutable:"writeonce"` // want Seq:`immutable\(tag, writeonce\)`
+	Z     int      `immutable:"yes"`       // want `invalid immutable tag on field Z` Z:`immutable\(type directive\)`
+}
+
+func move(p *Point) {
+	p.X = 1 // want `assignment to immutable field X`
+	p.Label = "moved"
+	p.Tags[0] = "a" // want `modifying immutable field Tags`
+	p.Z = 2         // want `assignment to immutable field Z`
+}
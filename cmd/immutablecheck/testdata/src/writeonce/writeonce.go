@@ -0,0 +1,104 @@
+package writeonce
+
+type Msg struct {
+	ID   int    `immutable:"writeonce"` // want ID:`immutable\(tag, writeonce\)`
+	Name string `immutable:"true"`      // want Name:`immutable\(tag\)`
+}
+
+func use(*Msg) {}
+
+func first() *Msg {
+	t := &Msg{}
+	t.ID = 1
+	return t
+}
+
+func second() *Msg {
+	t := &Msg{}
+	t.ID = 1
+	t.ID = 2 // want `assignment to immutable field ID`
+	return t
+}
+
+func literal() *Msg {
+	t := &Msg{ID: 1}
+	t.ID = 2 // want `assignment to immutable field ID`
+	return t
+}
+
+func branches(ok bool) *Msg {
+	t := &Msg{}
+	if ok {
+		t.ID = 1
+	} else {
+		t.ID = 2
+	}
+	return t
+}
+
+func afterBranch(ok bool) *Msg {
+	t := &Msg{}
+	if ok {
+		t.ID = 1
+	}
+	t.ID = 2 // want `assignment to immutable field ID`
+	return t
+}
+
+func escaped() *Msg {
+	t := &Msg{}
+	use(t)
+	t.ID = 1 // want `assignment to immutable field ID`
+	return t
+}
+
+func escapedAfter() *Msg {
+	t := &Msg{}
+	t.ID = 1
+	use(t)
+	return t
+}
+
+func param(t *Msg) {
+	t.ID = 1 // want `assignment to immutable field ID`
+}
+
+func notWriteOnce() *Msg {
+	t := &Msg{}
+	t.Name = "x" // want `assignment to immutable field Name`
+	return t
+}
+
+func allocInLoop(ids []int) []*Msg {
+	var out []*Msg
+	for _, id := range ids {
+		t := &Msg{}
+		t.ID = id
+		out = append(out, t)
+	}
+	return out
+}
+
+func allocBeforeLoop(ids []int) *Msg {
+	t := &Msg{}
+	for _, id := range ids {
+		t.ID = id // want `assignment to immutable field ID`
+	}
+	return t
+}
+
+// Constructors may initialise the object they return, whatever the tag.
+
+//immutable:constructor
+func NewMsg(name string) *Msg {
+	m := &Msg{}
+	m.Name = name
+	m.Name = name + "!"
+	return m
+}
+
+//immutable:constructor
+func Reset(m *Msg) *Msg {
+	m.Name = "" // want `assignment to immutable field Name`
+	return m
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"go/token"
+
+	"golang.org/x/tools/go/ssa"
+)
+
+// writeOnceAll enables write-once semantics for every immutable field: the
+// first assignment to a field of an object freshly allocated in the same
+// function is allowed, only later writes are reported.
+var writeOnceAll bool
+
+// fieldKey identifies one field of one fresh object.
+type fieldKey struct {
+	obj   ssa.Value
+	field int
+}
+
+// firstWrites returns the positions of the field stores in fns that are, on
+// every control-flow path, the first write to that field of an object for
+// which fresh reports true, such as one freshly allocated in the same function
+// (isAlloc). Positions are those of the selector's Sel identifier
+// (ssa.FieldAddr.Pos), so t.Id = 1 is keyed by the position of Id.
+//
+// Writes performed by composite literals (&pb.Person{Id: 1}) count as
+// writes, so a later t.Id = 2 is not a first write. A store inside a loop
+// that the object outlives can reach itself and is never a first write; if
+// the object is created in the loop body, each iteration writes a new one.
+// Any other use through which
+// the object or a field address escapes, such as passing t or &t.Id to a
+// function or storing it, may write the fields and counts as a write (see
+// escapes).
+func firstWrites(fns []*ssa.Function, fresh func(ssa.Value) bool) map[token.Pos]bool {
+	first := make(map[token.Pos]bool)
+	for _, fn := range fns {
+		stores := make(map[fieldKey][]*ssa.Store)
+		for _, b := range fn.Blocks {
+			for _, instr := range b.Instrs {
+				store, ok := instr.(*ssa.Store)
+				if !ok {
+					continue
+				}
+				fa, ok := store.Addr.(*ssa.FieldAddr)
+				if !ok {
+					continue
+				}
+				// Only objects created here are known to be fresh; anything
+				// reached through a parameter, global or free variable may
+				// already have been written elsewhere.
+				if !fresh(fa.X) {
+					continue
+				}
+				key := fieldKey{fa.X, fa.Field}
+				stores[key] = append(stores[key], store)
+			}
+		}
+
+		for key, group := range stores {
+			writes := escapes(key)
+			for _, store := range group {
+				writes = append(writes, store)
+			}
+			for _, s := range group {
+				isFirst := true
+				for _, other := range writes {
+					if mayPrecede(other, s, key.obj) {
+						isFirst = false
+						break
+					}
+				}
+				if isFirst && s.Addr.Pos().IsValid() {
+					first[s.Addr.Pos()] = true
+				}
+			}
+		}
+	}
+	return first
+}
+
+// escapes returns the instructions that may write the field key.field other
+// than plain stores to it: every use of key.obj other than selecting a field
+// or loading it, and every use of the field's address other than storing to
+// or loading from it. Such a use overwrites the whole object or lets it
+// escape into a call, a variable, an interface or a φ-node, through which any
+// field may be written.
+func escapes(key fieldKey) []ssa.Instruction {
+	var writes []ssa.Instruction
+	for _, ref := range *key.obj.Referrers() {
+		switch ref := ref.(type) {
+		case *ssa.FieldAddr:
+			if ref.Field != key.field {
+				continue
+			}
+			for _, use := range *ref.Referrers() {
+				if !isLoadOrStore(use, ref) {
+					writes = append(writes, use)
+				}
+			}
+		case *ssa.DebugRef:
+		case *ssa.UnOp:
+			if ref.Op != token.MUL {
+				writes = append(writes, ref)
+			}
+		default:
+			writes = append(writes, ref)
+		}
+	}
+	return writes
+}
+
+// isLoadOrStore reports whether instr only loads from or stores to the
+// address addr, without letting addr itself escape.
+func isLoadOrStore(instr ssa.Instruction, addr ssa.Value) bool {
+	switch instr := instr.(type) {
+	case *ssa.UnOp:
+		return instr.Op == token.MUL
+	case *ssa.Store:
+		return instr.Addr == addr && instr.Val != addr
+	}
+	return false
+}
+
+// isAlloc reports whether v is an object allocated in its function.
+func isAlloc(v ssa.Value) bool {
+	_, ok := v.(*ssa.Alloc)
+	return ok
+}
+
+// isClone reports whether v is a copy made by proto.Clone in its function,
+// as in c := proto.Clone(m).(*pb.T).
+func isClone(v ssa.Value) bool {
+	assert, ok := v.(*ssa.TypeAssert)
+	if !ok || assert.CommaOk {
+		return false
+	}
+	call, ok := assert.X.(*ssa.Call)
+	if !ok {
+		return false
+	}
+	callee := call.Call.StaticCallee()
+	return callee != nil && callee.Pkg != nil &&
+		callee.Pkg.Pkg.Path() == protoPkgPath && callee.Name() == "Clone"
+}
+
+// mayPrecede reports whether some control-flow path executes a before b
+// without creating obj, which both a and b use, anew in between. An
+// instruction may precede itself when it is inside a loop that obj outlives.
+func mayPrecede(a, b ssa.Instruction, obj ssa.Value) bool {
+	if a.Block() == b.Block() && a != b && instrIndex(a) < instrIndex(b) {
+		return true
+	}
+	// obj is defined before its uses in its block, so a path entering that
+	// block again creates a new object before reaching b.
+	var avoid *ssa.BasicBlock
+	if def, ok := obj.(ssa.Instruction); ok {
+		avoid = def.Block()
+	}
+	return blockReaches(a.Block(), b.Block(), avoid)
+}
+
+// blockReaches reports whether to is reachable from from by following at
+// least one edge, without entering avoid.
+func blockReaches(from, to, avoid *ssa.BasicBlock) bool {
+	seen := make(map[*ssa.BasicBlock]bool)
+	stack := append([]*ssa.BasicBlock(nil), from.Succs...)
+	for len(stack) > 0 {
+		b := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if b == avoid {
+			continue
+		}
+		if b == to {
+			return true
+		}
+		if !seen[b] {
+			seen[b] = true
+			stack = append(stack, b.Succs...)
+		}
+	}
+	return false
+}
+
+func instrIndex(instr ssa.Instruction) int {
+	for i, x := range instr.Block().Instrs {
+		if x == instr {
+			return i
+		}
+	}
+	return -1
+}
@@ -6,16 +6,19 @@ import (
 	"flag"
 	"fmt"
 	"go/ast"
+	"go/format"
 	"go/parser"
-	"go/printer"
 	"go/token"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
-	"google.golang.org/protobuf/proto"
-	"google.golang.org/protobuf/types/descriptorpb"
+	"goci-const-check/internal/directive"
+	"goci-const-check/internal/protoimmutable"
+
+	"golang.org/x/tools/go/packages"
 )
 
 var (
@@ -26,84 +29,30 @@ var (
 func main() {
 	flag.Parse()
 
-	b, err := ioutil.ReadFile(*descPath)
+	infos, err := protoimmutable.LoadDescriptorSet(*descPath)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "read desc: %v\n", err)
-		os.Exit(2)
-	}
-	var fds descriptorpb.FileDescriptorSet
-	if err := proto.Unmarshal(b, &fds); err != nil {
-		fmt.Fprintf(os.Stderr, "unmarshal descriptor set: %v\n", err)
+		fmt.Fprintf(os.Stderr, "load descriptor set: %v\n", err)
 		os.Exit(2)
 	}
 
-	// Map of fully-qualified message name -> set of field names that are immutable
-	// message name example: "example.Person"
-	imm := map[string]map[string]bool{}
-
-	for _, fd := range fds.File {
-		pkg := fd.GetPackage()
-		for _, md := range fd.MessageType {
-			msgName := md.GetName()
-			fullMsg := pkg
-			if fullMsg != "" {
-				fullMsg = fullMsg + "." + msgName
-			} else {
-				fullMsg = msgName
-			}
-			for _, fld := range md.Field {
-				opts := fld.GetOptions()
-				if opts == nil {
-					continue
-				}
-				// The custom option number we used: 51234 ; but we should check via protobuf reflection?
-				// Simpler: the descriptor encodes uninterpreted_options when option is unknown.
-				// We'll check UninterpretedOption for name "immutable"
-				if opts.GetImmutable_() { // Not available — can't rely on generated helpers here.
-					// NOTE: this line won't compile; we'll instead inspect UninterpretedOption.
-				}
-			}
+	// Map of generated Go type -> set of field names that are immutable
+	// type name example: "Person", or "Outer_Inner" for nested messages.
+	// Messages of different packages may share a Go name, so the type is
+	// identified by import path too.
+	imm := map[goType]map[string]bool{}
+	for _, info := range infos {
+		fields := map[string]bool{}
+		for _, name := range info.FieldNames {
+			fields[name] = true
 		}
+		imm[goType{info.GoImportPath, info.GoName}] = fields
 	}
 
-	// Because we don't have generated helper for custom extension in descriptorpb,
-	// inspect UninterpretedOption entries.
-	for _, fd := range fds.File {
-		pkg := fd.GetPackage()
-		for _, md := range fd.MessageType {
-			msgName := md.GetName()
-			fullMsg := pkg
-			if fullMsg != "" {
-				fullMsg = fullMsg + "." + msgName
-			} else {
-				fullMsg = msgName
-			}
-			for _, fld := range md.Field {
-				hasImmutable := false
-				for _, uo := range fld.GetOptions().GetUninterpretedOption() {
-					// uninterpreted option contains a name_parts slice, last part is the option name
-					// name example: "protooptions.immutable"
-					parts := []string{}
-					for _, np := range uo.GetName() {
-						parts = append(parts, np.GetNamePart())
-					}
-					n := strings.Join(parts, ".")
-					// For boolean option set to true, the "identifier_value" may be "true" or a positive string_value; also there is string_value or positive/negative/identifier
-					if strings.HasSuffix(n, "immutable") {
-						// check its value representation: identifier_value or positive_int_value etc.
-						if uo.GetIdentifierValue() == "true" || uo.GetStringValue() != nil && string(uo.GetStringValue()) == "true" {
-							hasImmutable = true
-						}
-					}
-				}
-				if hasImmutable {
-					if imm[fullMsg] == nil {
-						imm[fullMsg] = map[string]bool{}
-					}
-					imm[fullMsg][fld.GetName()] = true
-				}
-			}
-		}
+	// Import path of the package of each generated file
+	pkgPaths, err := packagePaths(*pbDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "load pb packages: %v\n", err)
+		os.Exit(2)
 	}
 
 	// DEBUG
@@ -126,7 +75,21 @@ func main() {
 		if err != nil {
 			return err
 		}
-		modified := false
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		pkgPath, ok := pkgPaths[abs]
+		if !ok {
+			// not part of the build (build tags, testdata, ...)
+			return nil
+		}
+		// Offsets of the lines of the fields to annotate. The directive is
+		// inserted as a doc comment line of its own: appended to an existing
+		// comment group without a position, the printer may move it below the
+		// field, where it documents the next one.
+		var inserts []int
+		tf := fset.File(f.Pos())
 
 		ast.Inspect(f, func(n ast.Node) bool {
 			// find type declarations
@@ -138,87 +101,66 @@ func main() {
 			if !ok || st.Fields == nil {
 				return true
 			}
-			// The generated protobuf struct type name is same as message name (CamelCase).
-			// Need to map package+Type => check messages in imm map for match.
-			typeName := ts.Name.Name // e.g., "Person"
-			// There is no direct package name in descriptor (full package + message).
-			// We'll try matching by suffix: any entry in imm whose last part equals typeName
-			for fullMsg, fields := range imm {
-				if !strings.HasSuffix(fullMsg, "."+typeName) && fullMsg != typeName {
+			// The generated protobuf struct type name is the protoc-gen-go identifier
+			// of the message, which the descriptor loader already computed.
+			fields, ok := imm[goType{pkgPath, ts.Name.Name}]
+			if !ok {
+				return true
+			}
+			// Iterate fields in AST struct and mark ones whose protobuf name matches.
+			for _, field := range st.Fields.List {
+				// get AST field name (Go exported name)
+				if len(field.Names) == 0 {
 					continue
 				}
-				// Found candidate: iterate fields in AST struct and mark ones whose JSON/protobuf name matches.
-				for _, field := range st.Fields.List {
-					// get AST field name (Go exported name)
-					if len(field.Names) == 0 {
-						continue
+				// Read the original proto name from the generated `protobuf:"...,name=xxx"`
+				// tag; protoc-gen-go's name mangling is not reversible in general.
+				protoName := ""
+				if field.Tag != nil {
+					if tag, err := strconv.Unquote(field.Tag.Value); err == nil {
+						protoName = protoimmutable.FieldName(tag)
 					}
-					goName := field.Names[0].Name // e.g., Id, Name, Age
-					// Convert goName to proto field name: protoc uses CamelCase <-> snake_case mapping.
-					// Easiest: check tag `protobuf` or `json` present in struct tag to find original proto name.
-					protoName := ""
-					if field.Tag != nil {
-						tag := strings.Trim(field.Tag.Value, "`")
-						// search for `protobuf:"...name=xxx..."`
-						// or `json:"name,omitempty"`
-						// Try json first
-						for _, part := range strings.Split(tag, " ") {
-							if strings.HasPrefix(part, "json:") {
-								v := strings.Trim(strings.TrimPrefix(part, "json:"), "\"")
-								// json tag might be "id,omitempty" -> take before comma
-								protoName = strings.Split(v, ",")[0]
-								break
-							}
+				}
+				if protoName == "" {
+					// not a proto field (internal state, oneof wrapper interface, ...)
+					continue
+				}
+				if fields[protoName] {
+					// add comment `// immutable` if not already present; prose
+					// such as "// NOT immutable" is not a directive
+					exists := false
+					for _, group := range []*ast.CommentGroup{field.Comment, field.Doc} {
+						if group == nil {
+							continue
 						}
-						if protoName == "" {
-							// try protobuf tag
-							for _, part := range strings.Split(tag, " ") {
-								if strings.HasPrefix(part, "protobuf:") {
-									v := strings.Trim(strings.TrimPrefix(part, "protobuf:"), "\"")
-									// format may include name=xxx
-									for _, seg := range strings.Split(v, ",") {
-										if strings.HasPrefix(seg, "name=") {
-											protoName = strings.TrimPrefix(seg, "name=")
-											break
-										}
-									}
-								}
+						for _, c := range group.List {
+							if d, _ := directive.ParseImmutable(c.Text, true); d != nil {
+								exists = true
 							}
 						}
 					}
-					if protoName == "" {
-						// fallback: guess by lowercasing first letter (not reliable). Skip if unknown.
-						continue
-					}
-					if fields[protoName] {
-						// add comment `// immutable` if not already present
-						exists := false
-						if field.Comment != nil {
-							for _, c := range field.Comment.List {
-								if strings.Contains(strings.ToLower(c.Text), "immutable") {
-									exists = true
-								}
-							}
-						}
-						if !exists {
-							if field.Comment == nil {
-								field.Comment = &ast.CommentGroup{}
-							}
-							field.Comment.List = append(field.Comment.List, &ast.Comment{Text: "// immutable"})
-							modified = true
-						}
+					if !exists {
+						inserts = append(inserts, tf.Offset(tf.LineStart(tf.Line(field.Pos()))))
 					}
 				}
 			}
 			return true
 		})
 
-		if modified {
-			var out bytes.Buffer
-			if err := printer.Fprint(&out, fset, f); err != nil {
+		if len(inserts) > 0 {
+			var buf bytes.Buffer
+			last := 0
+			for _, off := range inserts {
+				buf.Write(src[last:off])
+				buf.WriteString("// immutable\n")
+				last = off
+			}
+			buf.Write(src[last:])
+			out, err := format.Source(buf.Bytes())
+			if err != nil {
 				return err
 			}
-			if err := ioutil.WriteFile(path, out.Bytes(), 0644); err != nil {
+			if err := ioutil.WriteFile(path, out, 0644); err != nil {
 				return err
 			}
 			fmt.Printf("patched %s\n", path)
@@ -230,3 +172,26 @@ func main() {
 		os.Exit(2)
 	}
 }
+
+// goType identifies a generated message struct.
+type goType struct {
+	importPath string // e.g. "goci-const-check/pb"
+	name       string // e.g. "Person"
+}
+
+// packagePaths maps the absolute path of every Go file of the packages in
+// dir and its subdirectories to the import path of its package.
+func packagePaths(dir string) (map[string]string, error) {
+	cfg := &packages.Config{Mode: packages.NeedName | packages.NeedFiles, Dir: dir}
+	pkgs, err := packages.Load(cfg, "./...")
+	if err != nil {
+		return nil, err
+	}
+	paths := map[string]string{}
+	for _, pkg := range pkgs {
+		for _, file := range pkg.GoFiles {
+			paths[file] = pkg.PkgPath
+		}
+	}
+	return paths, nil
+}
@@ -0,0 +1,123 @@
+// Package directive parses the //goci:immutable comment directive, so that
+// the analyzer and the tools annotating generated code agree on what is one.
+package directive
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Immutable is a parsed //goci:immutable (or //immutable) directive:
+//
+//	//goci:immutable [deep] [reason="..."]
+type Immutable struct {
+	Deep   bool
+	Reason string
+}
+
+// Usage is quoted in near-miss diagnostics.
+const Usage = `//goci:immutable [deep] [reason="..."]`
+
+// ParseImmutable parses the text of a single comment. It returns the
+// directive, or nil if the comment is not one; nearMiss explains why a comment
+// that looks like a misspelled or malformed directive was rejected. Prose that
+// merely mentions the word ("// NOT immutable", "// Immutable after
+// creation.") is neither. A space after "//" is accepted only if allowSpace
+// is set: gofmt keeps it in field comments but directives in doc comments
+// must be written without it.
+//
+// Only directive-shaped comments are near misses: those without a space
+// after "//", with a namespace prefix (//gcoi:immutable), or whose first
+// word is one edit away from the directive name (// immutible). After a
+// space, a first argument that is neither one edit away from deep nor a
+// key=value pair marks the comment as prose too (// immutable after setup).
+func ParseImmutable(text string, allowSpace bool) (d *Immutable, nearMiss string) {
+	body, ok := strings.CutPrefix(text, "//")
+	if !ok {
+		return nil, "" // /* */ comments are never directives
+	}
+	spaced := body != "" && (body[0] == ' ' || body[0] == '\t')
+	if spaced && !allowSpace {
+		return nil, ""
+	}
+	body = strings.TrimLeft(body, " \t")
+	name, args, _ := strings.Cut(body, " ")
+
+	if name != "immutable" && name != "goci:immutable" {
+		word := strings.ToLower(strings.TrimRight(name, ".,;:"))
+		prefix := ""
+		if i := strings.LastIndexByte(word, ':'); i >= 0 {
+			prefix, word = word[:i], word[i+1:]
+		}
+		switch {
+		case word == "immutable" && prefix != "" && prefix != "goci":
+			return nil, fmt.Sprintf("unknown namespace %q", prefix)
+		case word == "immutable" && (prefix != "" || !spaced):
+			return nil, fmt.Sprintf("malformed directive name %q", name)
+		case editDistance(word, "immutable") == 1:
+			return nil, fmt.Sprintf("misspelled directive name %q", name)
+		}
+		return nil, ""
+	}
+
+	d = new(Immutable)
+	for args = strings.TrimSpace(args); args != ""; args = strings.TrimSpace(args) {
+		switch {
+		case args == "deep" || strings.HasPrefix(args, "deep "):
+			d.Deep = true
+			args = args[len("deep"):]
+		case strings.HasPrefix(args, "reason="):
+			reason, rest, err := UnquotePrefix(args[len("reason="):])
+			if err != nil {
+				return nil, fmt.Sprintf("reason must be a quoted string: %v", err)
+			}
+			d.Reason, args = reason, rest
+		default:
+			arg, _, _ := strings.Cut(args, " ")
+			if spaced && d.Reason == "" && !d.Deep && !strings.Contains(arg, "=") && editDistance(arg, "deep") > 1 {
+				return nil, "" // prose starting with the word
+			}
+			return nil, fmt.Sprintf("unknown argument %q", arg)
+		}
+	}
+	return d, ""
+}
+
+// UnquotePrefix unquotes the Go string literal at the start of s and returns
+// it together with the remainder of s.
+func UnquotePrefix(s string) (value, rest string, err error) {
+	lit, err := strconv.QuotedPrefix(s)
+	if err != nil {
+		return "", "", err
+	}
+	value, err = strconv.Unquote(lit)
+	return value, s[len(lit):], err
+}
+
+// editDistance returns the optimal string alignment distance between a and
+// b: the number of insertions, deletions, substitutions and transpositions of
+// adjacent bytes needed to turn a into b.
+func editDistance(a, b string) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(a)][len(b)]
+}
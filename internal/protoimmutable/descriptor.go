@@ -0,0 +1,357 @@
+// Package protoimmutable reads immutability options from protobuf descriptor
+// sets and maps the affected messages to their protoc-gen-go identifiers.
+package protoimmutable
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// ImmutableFieldInfo holds info about immutable fields from proto
+type ImmutableFieldInfo struct {
+	MessageName  string   // fully-qualified, e.g., "example.Person"
+	GoImportPath string   // from go_package, e.g., "goci-const-check/pb"
+	GoName       string   // generated Go type, e.g., "Person"
+	FieldNames   []string // e.g., ["id", "age"]
+
+	// DeepFieldNames is the subset of FieldNames that is deeply immutable:
+	// nothing reachable from these fields may be modified either.
+	DeepFieldNames []string
+
+	// Sources maps each of FieldNames to the option that made it immutable,
+	// e.g. "(example.immutable)" or "(example.immutable_message)".
+	Sources map[string]string
+
+	// ProtoFile is the .proto file declaring the message, as named in the
+	// descriptor set (relative to the protoc import path), e.g. "school.proto".
+	ProtoFile string
+	// Lines maps each of FieldNames to the 1-based line of its declaration in
+	// ProtoFile; it is empty unless the set was built with --include_source_info.
+	Lines map[string]int
+}
+
+// LoadDescriptorSet reads the protobuf descriptor set file. The result is
+// keyed by fully-qualified message name.
+func LoadDescriptorSet(path string) (map[string]*ImmutableFieldInfo, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var fds descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(data, &fds); err != nil {
+		return nil, err
+	}
+	return FromDescriptorSet(&fds)
+}
+
+// FromDescriptorSet collects the immutable fields declared in fds, keyed by
+// fully-qualified message name.
+func FromDescriptorSet(fds *descriptorpb.FileDescriptorSet) (map[string]*ImmutableFieldInfo, error) {
+	opts, err := newOptionResolver(fds)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]*ImmutableFieldInfo)
+	for _, fd := range fds.File {
+		// option (immutable_file) = true makes every message of the file
+		// immutable by default.
+		wholeFile, _, fileOpt, err := opts.boolOption(fd.GetOptions(), fileOptions, "immutable_file")
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", fd.GetName(), err)
+		}
+		if err := addMessages(result, opts, fd, optionSource(wholeFile, fileOpt), "", fd.MessageType); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// addMessages records the immutable fields of msgs and, recursively, of their
+// nested messages. wholeFile is the file-level default option, "" if the file
+// is not immutable by default; parent is the dotted name of the enclosing
+// message relative to the proto package ("" for top-level messages).
+func addMessages(result map[string]*ImmutableFieldInfo, opts *optionResolver, fd *descriptorpb.FileDescriptorProto, wholeFile string, parent string, msgs []*descriptorpb.DescriptorProto) error {
+	for _, msg := range msgs {
+		// Map entries have no generated Go type.
+		if msg.GetOptions().GetMapEntry() {
+			continue
+		}
+		relName := msg.GetName()
+		if parent != "" {
+			relName = parent + "." + relName
+		}
+		info := &ImmutableFieldInfo{
+			MessageName:  fullName(fd.GetPackage(), relName),
+			GoImportPath: goImportPath(fd),
+			GoName:       GoCamelCase(relName), // Outer.Inner -> Outer_Inner
+			FieldNames:   []string{},
+			Sources:      make(map[string]string),
+			ProtoFile:    fd.GetName(),
+			Lines:        make(map[string]int),
+		}
+
+		// option (immutable_message) = true makes every field immutable; an
+		// explicit false opts the message out of the file-level default.
+		whole, set, msgOpt, err := opts.boolOption(msg.GetOptions(), messageOptions, "immutable_message")
+		if err != nil {
+			return fmt.Errorf("%s: message %s: %v", fd.GetName(), info.MessageName, err)
+		}
+		wholeSource := optionSource(whole, msgOpt)
+		if !set {
+			wholeSource = wholeFile
+		}
+
+		for _, field := range msg.Field {
+			immutable, _, immutableOpt, err := opts.boolOption(field.GetOptions(), fieldOptions, "immutable")
+			if err != nil {
+				return fmt.Errorf("%s: field %s.%s: %v", fd.GetName(), info.MessageName, field.GetName(), err)
+			}
+			deep, _, deepOpt, err := opts.boolOption(field.GetOptions(), fieldOptions, "deep_immutable")
+			if err != nil {
+				return fmt.Errorf("%s: field %s.%s: %v", fd.GetName(), info.MessageName, field.GetName(), err)
+			}
+			mutable, _, _, err := opts.boolOption(field.GetOptions(), fieldOptions, "mutable")
+			if err != nil {
+				return fmt.Errorf("%s: field %s.%s: %v", fd.GetName(), info.MessageName, field.GetName(), err)
+			}
+			if mutable && (immutable || deep) {
+				return fmt.Errorf("%s: field %s.%s: both mutable and immutable", fd.GetName(), info.MessageName, field.GetName())
+			}
+			if mutable {
+				// (mutable) = true opts the field out of message and file defaults.
+				continue
+			}
+			// The most specific option is reported as the source.
+			source := optionSource(deep, deepOpt)
+			if source == "" {
+				source = optionSource(immutable, immutableOpt)
+			}
+			if source == "" {
+				source = wholeSource
+			}
+			if source != "" {
+				info.FieldNames = append(info.FieldNames, field.GetName())
+				info.Sources[field.GetName()] = source
+				if line := opts.fieldLine(info.MessageName, field.GetName()); line > 0 {
+					info.Lines[field.GetName()] = line
+				}
+			}
+			if deep {
+				info.DeepFieldNames = append(info.DeepFieldNames, field.GetName())
+			}
+		}
+
+		if len(info.FieldNames) > 0 {
+			result[info.MessageName] = info
+		}
+
+		if err := addMessages(result, opts, fd, wholeFile, relName, msg.NestedType); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const (
+	fieldOptions   protoreflect.FullName = "google.protobuf.FieldOptions"
+	messageOptions protoreflect.FullName = "google.protobuf.MessageOptions"
+	fileOptions    protoreflect.FullName = "google.protobuf.FileOptions"
+)
+
+// optionResolver decodes custom options using the extensions declared in the
+// descriptor set itself, so options are matched by name and type rather than
+// by their wire encoding. It also locates declarations in the set's sources.
+type optionResolver struct {
+	files *protoregistry.Files
+	types *protoregistry.Types
+	bools map[optionKey][]protoreflect.ExtensionType // bool extensions by extendee and name
+}
+
+type optionKey struct {
+	extendee protoreflect.FullName // e.g., google.protobuf.FieldOptions
+	name     protoreflect.Name     // e.g., immutable
+}
+
+func newOptionResolver(fds *descriptorpb.FileDescriptorSet) (*optionResolver, error) {
+	files, err := protodesc.FileOptions{AllowUnresolvable: true}.NewFiles(fds)
+	if err != nil {
+		return nil, fmt.Errorf("build file registry: %v", err)
+	}
+
+	r := &optionResolver{
+		files: files,
+		types: new(protoregistry.Types),
+		bools: make(map[optionKey][]protoreflect.ExtensionType),
+	}
+	var regErr error
+	files.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		exts := fd.Extensions()
+		for i := 0; i < exts.Len(); i++ {
+			xt := dynamicpb.NewExtensionType(exts.Get(i))
+			if err := r.types.RegisterExtension(xt); err != nil {
+				regErr = err
+				return false
+			}
+			xd := xt.TypeDescriptor()
+			if xd.Kind() == protoreflect.BoolKind {
+				key := optionKey{xd.ContainingMessage().FullName(), xd.Name()}
+				r.bools[key] = append(r.bools[key], xt)
+			}
+		}
+		return true
+	})
+	if regErr != nil {
+		return nil, fmt.Errorf("register extensions: %v", regErr)
+	}
+	return r, nil
+}
+
+// boolOption reports the value of the bool option called name on opts, an
+// options message of type extendee, whether the option is set at all, and
+// the full name of the extension that set it. Options of that name declared
+// in any proto package are honoured.
+func (r *optionResolver) boolOption(opts proto.Message, extendee protoreflect.FullName, name protoreflect.Name) (value, set bool, ext protoreflect.FullName, err error) {
+	exts := r.bools[optionKey{extendee, name}]
+	if len(exts) == 0 || opts == nil || !opts.ProtoReflect().IsValid() {
+		return false, false, "", nil
+	}
+	m, err := r.resolve(opts)
+	if err != nil {
+		return false, false, "", err
+	}
+	for _, xt := range exts {
+		xd := xt.TypeDescriptor()
+		if m.Has(xd) && (!set || m.Get(xd).Bool()) {
+			set, ext = true, xd.FullName()
+			value = value || m.Get(xd).Bool()
+		}
+	}
+	return value, set, ext, nil
+}
+
+// optionSource formats the option ext as written in a .proto file, e.g.
+// "(example.immutable)", if value is true, and returns "" otherwise.
+func optionSource(value bool, ext protoreflect.FullName) string {
+	if !value {
+		return ""
+	}
+	return "(" + string(ext) + ")"
+}
+
+// resolve re-parses an options message so that extensions which were kept as
+// unknown fields while decoding the set are populated.
+func (r *optionResolver) resolve(opts proto.Message) (protoreflect.Message, error) {
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(opts)
+	if err != nil {
+		return nil, err
+	}
+	m := opts.ProtoReflect().New()
+	if err := (proto.UnmarshalOptions{Resolver: r.types}).Unmarshal(b, m.Interface()); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// fieldLine returns the 1-based line declaring field of message msg, or 0 if
+// the descriptor set carries no source info for it.
+func (r *optionResolver) fieldLine(msg, field string) int {
+	d, err := r.files.FindDescriptorByName(protoreflect.FullName(msg))
+	if err != nil {
+		return 0
+	}
+	md, ok := d.(protoreflect.MessageDescriptor)
+	if !ok {
+		return 0
+	}
+	fd := md.Fields().ByName(protoreflect.Name(field))
+	if fd == nil {
+		return 0
+	}
+	loc := fd.ParentFile().SourceLocations().ByDescriptor(fd)
+	if loc.Path == nil {
+		return 0
+	}
+	return loc.StartLine + 1
+}
+
+// fullName joins a proto package and a message name.
+func fullName(pkg, name string) string {
+	if pkg == "" {
+		return name
+	}
+	return pkg + "." + name
+}
+
+// goImportPath returns the Go import path from the go_package option, dropping
+// an explicit package name suffix ("path;name").
+func goImportPath(fd *descriptorpb.FileDescriptorProto) string {
+	p := fd.GetOptions().GetGoPackage()
+	if i := strings.IndexByte(p, ';'); i >= 0 {
+		p = p[:i]
+	}
+	return p
+}
+
+// GoCamelCase converts a proto identifier to the Go identifier generated by
+// protoc-gen-go (see google.golang.org/protobuf/internal/strs.GoCamelCase).
+func GoCamelCase(s string) string {
+	var b []byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '.' && i+1 < len(s) && isASCIILower(s[i+1]):
+			// Skip over '.' in ".{{lowercase}}".
+		case c == '.':
+			b = append(b, '_')
+		case c == '_' && (i == 0 || s[i-1] == '.'):
+			// Convert initial '_' to ensure we start with a capital letter.
+			b = append(b, 'X')
+		case c == '_' && i+1 < len(s) && isASCIILower(s[i+1]):
+			// Skip over '_' in "_{{lowercase}}".
+		case isASCIIDigit(c):
+			b = append(b, c)
+		default:
+			// The next word is a sequence of characters that must start upper case.
+			if isASCIILower(c) {
+				c -= 'a' - 'A'
+			}
+			b = append(b, c)
+			// Accept lower case sequence that follows.
+			for ; i+1 < len(s) && isASCIILower(s[i+1]); i++ {
+				b = append(b, s[i+1])
+			}
+		}
+	}
+	return string(b)
+}
+
+// FieldName returns the proto field name recorded by protoc-gen-go in the
+// `protobuf:"...,name=xxx,..."` tag of a generated struct field, or "" if the
+// field carries no such tag. Reading the tag avoids re-deriving the name
+// mangling (conflict suffixes such as Reset_, digits after underscores, ...).
+func FieldName(tag string) string {
+	v, ok := reflect.StructTag(tag).Lookup("protobuf")
+	if !ok {
+		return ""
+	}
+	for _, seg := range strings.Split(v, ",") {
+		if name, ok := strings.CutPrefix(seg, "name="); ok {
+			return name
+		}
+	}
+	return ""
+}
+
+func isASCIILower(c byte) bool { return 'a' <= c && c <= 'z' }
+func isASCIIDigit(c byte) bool { return '0' <= c && c <= '9' }
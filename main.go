@@ -1,6 +1,10 @@
 package main
 
 import (
+	"fmt"
+	"sort"
+
+	"goci-const-check/model"
 	pb "goci-const-check/pb"
 )
 
@@ -33,4 +37,45 @@ func main() {
 	School.Teachers = team2
 
 	School.Teachers.Teachers[5] = &pb.Person{Id: 5, Name: "Ms. New", Age: 29}
+
+	u := &model.User{}
+	u.ID = 7
+	u.Name = "Bob"
+	u.Email = "bob@example.com"
+	u.Email += ".cn"
+	t.Age += 1
+	t.Id <<= 2
+
+	ptr := &t.Id
+	*ptr = 5
+	fmt.Sscan("42", &t.Age)
+
+	delete(School.Teachers.Teachers, 1)
+	clear(team.Teachers)
+	sort.Strings(u.Roles)
+	copy(u.Roles, []string{"admin"})
+	u.Roles = append(u.Roles, "guest")
+	_ = append(u.Roles[:0], "root")
+
+	School.GetTeachers().Teachers[6] = &pb.Person{Id: 6}
+	team.GetTeachers()[1] = &pb.Person{Id: 7}
+	delete(team.GetTeachers(), 2)
+
+	School.Teachers.Teachers[5].Name = "Ms. Renamed"
+	School.GetTeachers().GetTeachers()[5].Name += "!"
+	name := &School.Teachers.Teachers[5].Name
+	*name = "Ms. Alias"
+
+	price := model.Money{Currency: "EUR", Amount: 100}
+	price.Amount = 120
+
+	u.Touch()
+	u.Version = 0
+
+	acct := &model.Account{User: u}
+	acct.Backup = "carol"
+	acct.Balance = 10
+	acct.Money = model.Money{Currency: "USD"}
+
+	t.Id = 99 //immutablecheck:ignore reason="legacy id migration"
 }
@@ -0,0 +1,65 @@
+// Package model holds plain Go structs whose immutable fields are marked with
+// struct tags or comments instead of proto options.
+package model
+
+type User struct {
+	ID      int64 `immutable:"true"`
+	Name    string
+	Email   string   // immutable
+	Created int64    `json:"created" immutable:"1"`
+	Roles   []string // immutable
+	Version int64    `immutable:"external" json:"version"`
+}
+
+// Touch records a change; User's own package may update Version.
+func (u *User) Touch() {
+	u.Version++
+}
+
+// Money is a value object: none of its fields may change once built.
+//
+//goci:immutable
+type Money struct {
+	Currency string
+	Amount   int64
+}
+
+// Account mixes the field layouts markers must be mapped through: several
+// names on one line share their marker, and embedded fields take theirs from
+// the embedded type's position.
+type Account struct {
+	Owner, Backup string // immutable
+	Balance       int64
+	Money         `immutable:"true"`
+	*User
+}
+
+// NewUser builds a user; with -constructors=New* it may set immutable fields
+// of the user it returns.
+func NewUser(id int64, email string) *User {
+	u := &User{}
+	u.ID = id
+	u.Email = email
+	return u
+}
+
+// Rename is not a constructor: the user is not allocated here.
+func Rename(u *User, email string) {
+	u.Email = email
+}
+
+// NewAlias writes to a user it does not return, which constructors may not.
+func NewAlias(src *User) *User {
+	src.Email = "alias@" + src.Email
+	return &User{Name: src.Name}
+}
+
+// Euros builds a Money value in place.
+//
+//immutable:constructor
+func Euros(amount int64) Money {
+	var m Money
+	m.Currency = "EUR"
+	m.Amount = amount
+	return m
+}
@@ -30,12 +30,60 @@ var file_immutable_options_proto_extTypes = []protoimpl.ExtensionInfo{
 		Tag:           "varint,59527,opt,name=immutable",
 		Filename:      "immutable_options.proto",
 	},
+	{
+		ExtendedType:  (*descriptorpb.FieldOptions)(nil),
+		ExtensionType: (*bool)(nil),
+		Field:         59528,
+		Name:          "example.deep_immutable",
+		Tag:           "varint,59528,opt,name=deep_immutable",
+		Filename:      "immutable_options.proto",
+	},
+	{
+		ExtendedType:  (*descriptorpb.FieldOptions)(nil),
+		ExtensionType: (*bool)(nil),
+		Field:         59530,
+		Name:          "example.mutable",
+		Tag:           "varint,59530,opt,name=mutable",
+		Filename:      "immutable_options.proto",
+	},
+	{
+		ExtendedType:  (*descriptorpb.MessageOptions)(nil),
+		ExtensionType: (*bool)(nil),
+		Field:         59529,
+		Name:          "example.immutable_message",
+		Tag:           "varint,59529,opt,name=immutable_message",
+		Filename:      "immutable_options.proto",
+	},
+	{
+		ExtendedType:  (*descriptorpb.FileOptions)(nil),
+		ExtensionType: (*bool)(nil),
+		Field:         59531,
+		Name:          "example.immutable_file",
+		Tag:           "varint,59531,opt,name=immutable_file",
+		Filename:      "immutable_options.proto",
+	},
 }
 
 // Extension fields to descriptorpb.FieldOptions.
 var (
 	// optional bool immutable = 59527;
 	E_Immutable = &file_immutable_options_proto_extTypes[0] // 唯一标识符应大于 50000，以避免与预定义选项冲突
+	// optional bool deep_immutable = 59528;
+	E_DeepImmutable = &file_immutable_options_proto_extTypes[1] // 隐含 immutable，且从该字段可达的内容（嵌套字段、map/slice 元素）都不可修改
+	// optional bool mutable = 59530;
+	E_Mutable = &file_immutable_options_proto_extTypes[2] // 显式声明字段可变，覆盖消息/文件级别的默认 immutable
+)
+
+// Extension fields to descriptorpb.MessageOptions.
+var (
+	// optional bool immutable_message = 59529;
+	E_ImmutableMessage = &file_immutable_options_proto_extTypes[3] // 消息的所有字段都是 immutable
+)
+
+// Extension fields to descriptorpb.FileOptions.
+var (
+	// optional bool immutable_file = 59531;
+	E_ImmutableFile = &file_immutable_options_proto_extTypes[4] // 文件中所有消息默认 immutable（可用 mutable 逐字段排除）
 )
 
 var File_immutable_options_proto protoreflect.FileDescriptor
@@ -43,17 +91,27 @@ var File_immutable_options_proto protoreflect.FileDescriptor
 const file_immutable_options_proto_rawDesc = "" +
 	"\n" +
 	"\x17immutable_options.proto\x12\aexample\x1a google/protobuf/descriptor.proto:=\n" +
-	"\timmutable\x12\x1d.google.protobuf.FieldOptions\x18\x87\xd1\x03 \x01(\bR\timmutableB\x15Z\x13goci-const-check/pbb\x06proto3"
+	"\timmutable\x12\x1d.google.protobuf.FieldOptions\x18\x87\xd1\x03 \x01(\bR\timmutable:F\n" +
+	"\x0edeep_immutable\x12\x1d.google.protobuf.FieldOptions\x18\x88\xd1\x03 \x01(\bR\rdeepImmutable:9\n" +
+	"\amutable\x12\x1d.google.protobuf.FieldOptions\x18\x8a\xd1\x03 \x01(\bR\amutable:N\n" +
+	"\x11immutable_message\x12\x1f.google.protobuf.MessageOptions\x18\x89\xd1\x03 \x01(\bR\x10immutableMessage:E\n" +
+	"\x0eimmutable_file\x12\x1c.google.protobuf.FileOptions\x18\x8b\xd1\x03 \x01(\bR\rimmutableFileB\x15Z\x13goci-const-check/pbb\x06proto3"
 
 var file_immutable_options_proto_goTypes = []any{
-	(*descriptorpb.FieldOptions)(nil), // 0: google.protobuf.FieldOptions
+	(*descriptorpb.FieldOptions)(nil),   // 0: google.protobuf.FieldOptions
+	(*descriptorpb.MessageOptions)(nil), // 1: google.protobuf.MessageOptions
+	(*descriptorpb.FileOptions)(nil),    // 2: google.protobuf.FileOptions
 }
 var file_immutable_options_proto_depIdxs = []int32{
 	0, // 0: example.immutable:extendee -> google.protobuf.FieldOptions
-	1, // [1:1] is the sub-list for method output_type
-	1, // [1:1] is the sub-list for method input_type
-	1, // [1:1] is the sub-list for extension type_name
-	0, // [0:1] is the sub-list for extension extendee
+	0, // 1: example.deep_immutable:extendee -> google.protobuf.FieldOptions
+	0, // 2: example.mutable:extendee -> google.protobuf.FieldOptions
+	1, // 3: example.immutable_message:extendee -> google.protobuf.MessageOptions
+	2, // 4: example.immutable_file:extendee -> google.protobuf.FileOptions
+	5, // [5:5] is the sub-list for method output_type
+	5, // [5:5] is the sub-list for method input_type
+	5, // [5:5] is the sub-list for extension type_name
+	0, // [0:5] is the sub-list for extension extendee
 	0, // [0:0] is the sub-list for field type_name
 }
 
@@ -69,7 +127,7 @@ func file_immutable_options_proto_init() {
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_immutable_options_proto_rawDesc), len(file_immutable_options_proto_rawDesc)),
 			NumEnums:      0,
 			NumMessages:   0,
-			NumExtensions: 1,
+			NumExtensions: 5,
 			NumServices:   0,
 		},
 		GoTypes:           file_immutable_options_proto_goTypes,
@@ -133,7 +133,7 @@ const file_school_proto_rawDesc = "" +
 	"\x06School\x12\x12\n" +
 	"\x04name\x18\x01 \x01(\tR\x04name\x12\x18\n" +
 	"\aaddress\x18\x02 \x01(\tR\aaddress\x126\n" +
-	"\bteachers\x18\x03 \x01(\v2\x14.example.TeacherTeamB\x04\xb8\x88\x1d\x01R\bteachers\"\xa1\x01\n" +
+	"\bteachers\x18\x03 \x01(\v2\x14.example.TeacherTeamB\x04\xc0\x88\x1d\x01R\bteachers\"\xa1\x01\n" +
 	"\vTeacherTeam\x12D\n" +
 	"\bteachers\x18\x01 \x03(\v2\".example.TeacherTeam.TeachersEntryB\x04\xb8\x88\x1d\x01R\bteachers\x1aL\n" +
 	"\rTeachersEntry\x12\x10\n" +
@@ -2,4 +2,4 @@
 protoc.exe --proto_path=../proto --go_out=paths=source_relative:../pb ../proto/*.proto
 
 :: 生成 descriptor set（包含自定义 options）
-protoc.exe --proto_path=../proto --include_imports --descriptor_set_out=../pb/descriptor/all.protos.pb ../proto/*.proto
\ No newline at end of file
+protoc.exe --proto_path=../proto --include_imports --include_source_info --descriptor_set_out=../pb/descriptor/all.protos.pb ../proto/*.proto
\ No newline at end of file